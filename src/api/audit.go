@@ -0,0 +1,35 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"log"
+	"net/http"
+)
+
+type AuditResponse struct {
+	Success bool      `json:"success"`
+	Data    AuditData `json:"data,omitempty"`
+}
+
+type AuditData struct {
+	Error   string                `json:"error,omitempty"`
+	Entries []database.AuditEntry `json:"entries,omitempty"`
+}
+
+var AuditFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see the audit log
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, AuditResponse{Success: false, Data: AuditData{Error: keyError}}, "audit")
+		return
+	}
+
+	entries, err := database.Connection.GetAudit(100)
+	if err != nil {
+		log.Println("error getting audit log:", err)
+		writeJSON(writer, http.StatusInternalServerError, AuditResponse{Success: false, Data: AuditData{Error: err.Error()}}, "audit")
+		return
+	}
+	writeJSON(writer, http.StatusOK, AuditResponse{Success: true, Data: AuditData{Entries: entries}}, "audit")
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type BatchesResponse struct {
+	Success bool        `json:"success"`
+	Data    BatchesData `json:"data,omitempty"`
+}
+
+type BatchesData struct {
+	Error   string           `json:"error,omitempty"`
+	Batch   *database.Batch  `json:"batch,omitempty"`
+	Batches []database.Batch `json:"batches,omitempty"`
+	Removed int              `json:"removed,omitempty"`
+}
+
+var BatchesFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see import batches
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, BatchesResponse{Success: false, Data: BatchesData{Error: keyError}}, "batches")
+		return
+	}
+
+	// an empty pool lists the batches of every pool
+	pool := request.URL.Query().Get("pool")
+	if pool != "" && !database.IsValidPoolName(pool) {
+		writeJSON(writer, http.StatusBadRequest, BatchesResponse{Success: false, Data: BatchesData{Error: "invalid pool"}}, "batches")
+		return
+	}
+
+	batches, err := database.Connection.GetBatches(pool, 50)
+	if err != nil {
+		log.Println("error getting batches:", err)
+		writeJSON(writer, http.StatusInternalServerError, BatchesResponse{Success: false, Data: BatchesData{Error: err.Error()}}, "batches")
+		return
+	}
+	writeJSON(writer, http.StatusOK, BatchesResponse{Success: true, Data: BatchesData{Batches: batches}}, "batches")
+}
+
+var BatchFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see import batches
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, BatchesResponse{Success: false, Data: BatchesData{Error: keyError}}, "batch")
+		return
+	}
+
+	batchId, err := strconv.ParseInt(chi.URLParam(request, "id"), 10, 64)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, BatchesResponse{Success: false, Data: BatchesData{Error: "invalid batch id"}}, "batch")
+		return
+	}
+
+	batch, err := database.Connection.GetBatch(batchId)
+	if errors.Is(err, database.ErrBatchNotFound) {
+		writeJSON(writer, http.StatusNotFound, BatchesResponse{Success: false, Data: BatchesData{Error: err.Error()}}, "batch")
+		return
+	}
+	if err != nil {
+		log.Println("error getting batch:", err)
+		writeJSON(writer, http.StatusInternalServerError, BatchesResponse{Success: false, Data: BatchesData{Error: err.Error()}}, "batch")
+		return
+	}
+	writeJSON(writer, http.StatusOK, BatchesResponse{Success: true, Data: BatchesData{Batch: batch}}, "batch")
+}
+
+var RollbackBatchFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can roll back import batches
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, BatchesResponse{Success: false, Data: BatchesData{Error: keyError}}, "rollback batch")
+		return
+	}
+
+	batchId, err := strconv.ParseInt(chi.URLParam(request, "id"), 10, 64)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, BatchesResponse{Success: false, Data: BatchesData{Error: "invalid batch id"}}, "rollback batch")
+		return
+	}
+
+	removed, err := database.Connection.RollbackBatch(batchId)
+	switch {
+	case errors.Is(err, database.ErrBatchNotFound):
+		writeJSON(writer, http.StatusNotFound, BatchesResponse{Success: false, Data: BatchesData{Error: err.Error()}}, "rollback batch")
+		return
+	case errors.Is(err, database.ErrBatchRolledBack), errors.Is(err, database.ErrBatchImporting):
+		writeJSON(writer, http.StatusConflict, BatchesResponse{Success: false, Data: BatchesData{Error: err.Error()}}, "rollback batch")
+		return
+	case err != nil:
+		log.Println("error rolling back batch:", err)
+		writeJSON(writer, http.StatusInternalServerError, BatchesResponse{Success: false, Data: BatchesData{Error: err.Error()}}, "rollback batch")
+		return
+	}
+	writeJSON(writer, http.StatusOK, BatchesResponse{Success: true, Data: BatchesData{Removed: removed}}, "rollback batch")
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"errors"
+	"log"
+	"net/http"
+)
+
+type ConfirmResponse struct {
+	Success bool        `json:"success"`
+	Data    ConfirmData `json:"data,omitempty"`
+}
+
+type ConfirmData struct {
+	Error     string         `json:"error,omitempty"`
+	Confirmed int            `json:"confirmed,omitempty"`
+	Items     []GenerateItem `json:"items,omitempty"`
+}
+
+var ConfirmFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// check the key is usable, a disabled key can't take the alts it leased before
+	key := request.URL.Query().Get("key")
+	status, keyError := authorizeKey(key, false)
+	if keyError != "" {
+		writeJSON(writer, status, ConfirmResponse{Success: false, Data: ConfirmData{Error: keyError}}, "confirm")
+		return
+	}
+	leaseId := request.URL.Query().Get("lease")
+	if leaseId == "" {
+		writeJSON(writer, http.StatusBadRequest, ConfirmResponse{Success: false, Data: ConfirmData{Error: "lease not set"}}, "confirm")
+		return
+	}
+
+	// remove the leased alts from stock
+	alts, err := database.Connection.ConfirmLease(key, leaseId)
+	if errors.Is(err, database.ErrLeaseNotFound) {
+		writeJSON(writer, http.StatusNotFound, ConfirmResponse{Success: false, Data: ConfirmData{Error: err.Error()}}, "confirm")
+		return
+	}
+	if err != nil {
+		log.Println("error confirming lease:", err)
+		writeJSON(writer, http.StatusInternalServerError, ConfirmResponse{Success: false, Data: ConfirmData{Error: err.Error()}}, "confirm")
+		return
+	}
+
+	response := ConfirmResponse{
+		Success: true,
+		Data: ConfirmData{
+			Confirmed: len(alts),
+		},
+	}
+	// the confirmed items carry the dispense ids needed to report them
+	for _, alt := range alts {
+		response.Data.Items = append(response.Data.Items, GenerateItem{
+			Id:       alt.DispenseId,
+			Email:    alt.Email,
+			Password: alt.Password,
+			Combo:    alt.Email + ":" + alt.Password,
+		})
+	}
+	writeJSON(writer, http.StatusOK, response, "confirm")
+}
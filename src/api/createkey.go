@@ -19,7 +19,12 @@ type CreateKeyData struct {
 }
 
 type CreateKeyRequest struct {
-	Owner string `json:"owner"`
+	Owner    string `json:"owner"`
+	MaxBatch int    `json:"max_batch,omitempty"`
+	Quota    int    `json:"quota,omitempty"`
+	// ReplaceLimit is how many replacements the key may receive per day, 0 uses the server default
+	ReplaceLimit int      `json:"replace_limit,omitempty"`
+	Pools        []string `json:"pools,omitempty"`
 }
 
 var CreateKeyFunc = func(writer http.ResponseWriter, request *http.Request) {
@@ -143,8 +148,48 @@ var CreateKeyFunc = func(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	// check the key limits are sane
+	if requestData.MaxBatch < 0 || requestData.Quota < 0 || requestData.ReplaceLimit < 0 {
+		response := CreateKeyResponse{
+			Success: false,
+			Data: CreateKeyData{
+				Error: "max_batch, quota and replace_limit can not be negative",
+			},
+		}
+		responsePayload, err := json.Marshal(response)
+		if err != nil {
+			log.Println("error marshalling create key response (invalid limits):", err)
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusBadRequest)
+		_, err = writer.Write(responsePayload)
+		return
+	}
+
+	// check the pools the key is restricted to are valid
+	for _, pool := range requestData.Pools {
+		if _, ok := parsePool(pool); !ok || pool == "" {
+			response := CreateKeyResponse{
+				Success: false,
+				Data: CreateKeyData{
+					Error: "invalid pool " + pool,
+				},
+			}
+			responsePayload, err := json.Marshal(response)
+			if err != nil {
+				log.Println("error marshalling create key response (invalid pool):", err)
+				writer.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writer.WriteHeader(http.StatusBadRequest)
+			_, err = writer.Write(responsePayload)
+			return
+		}
+	}
+
 	// create key
-	err = database.Connection.CreateApiKey(requestData.Owner, 12)
+	err = database.Connection.CreateApiKey(requestData.Owner, 12, requestData.MaxBatch, requestData.Quota, requestData.ReplaceLimit, requestData.Pools)
 	if err != nil {
 		log.Println("error creating api key:", err)
 		response := CreateKeyResponse{
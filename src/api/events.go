@@ -0,0 +1,148 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// HeartbeatInterval is how often a comment is sent on idle event streams so proxies don't close them
+var HeartbeatInterval = 15 * time.Second
+
+// streamedEvents are the events sent on /events, and if only admins get them
+var streamedEvents = map[string]bool{
+	database.EventStockChanged:     false,
+	database.EventRestockCompleted: false,
+	database.EventItemDispensed:    true,
+}
+
+type EventsResponse struct {
+	Success bool       `json:"success"`
+	Data    EventsData `json:"data,omitempty"`
+}
+
+type EventsData struct {
+	Error string `json:"error,omitempty"`
+}
+
+/*
+writeEvent ~ writes an event in the server-sent events format, events without an id don't move the client's last event id
+*/
+func writeEvent(writer http.ResponseWriter, id string, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(writer, "id: %s\n", id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", eventType, payload)
+	return err
+}
+
+/*
+streamEvent ~ writes a bus event if the client may see it, restocks are sent without who restocked to everyone but admins
+*/
+func streamEvent(writer http.ResponseWriter, event database.BusEvent, admin bool) error {
+	adminOnly, streamed := streamedEvents[event.Type]
+	if !streamed || (adminOnly && !admin) {
+		return nil
+	}
+	data := event.Data
+	if restock, ok := data.(database.RestockEvent); ok && !admin {
+		restock.Owner = ""
+		data = restock
+	}
+	return writeEvent(writer, event.Id, event.Type, data)
+}
+
+var EventsFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// dispenses are only streamed to admins
+	admin := false
+	if key := request.URL.Query().Get("key"); key != "" {
+		status, keyError := authorizeKey(key, true)
+		if keyError != "" {
+			writeJSON(writer, status, EventsResponse{Success: false, Data: EventsData{Error: keyError}}, "events")
+			return
+		}
+		admin = true
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeJSON(writer, http.StatusInternalServerError, EventsResponse{Success: false, Data: EventsData{Error: "streaming not supported"}}, "events")
+		return
+	}
+
+	// browsers send the last event id as a header when reconnecting, the query is for clients that can't set headers
+	lastEventId := request.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = request.URL.Query().Get("last_event_id")
+	}
+	subscription, missed, resumed := database.SubscribeEvents(lastEventId)
+	defer database.UnsubscribeEvents(subscription)
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set("Connection", "keep-alive")
+	// stops nginx from buffering the stream
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	// clients that can't resume get the stock of every pool to start from
+	if !resumed {
+		pools, err := database.Connection.GetStockPerPool()
+		if err != nil {
+			log.Println("error getting stock for event stream:", err)
+			return
+		}
+		names := make([]string, 0, len(pools))
+		for pool := range pools {
+			names = append(names, pool)
+		}
+		sort.Strings(names)
+		for _, pool := range names {
+			err = writeEvent(writer, "", database.EventStockChanged, database.StockEvent{Pool: pool, Stock: pools[pool]})
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, event := range missed {
+		if streamEvent(writer, event, admin) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event, ok := <-subscription.Events:
+			// the subscription is closed when the client fell behind, it resumes from its last event when it reconnects
+			if !ok {
+				return
+			}
+			if streamEvent(writer, event, admin) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(writer, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
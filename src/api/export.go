@@ -0,0 +1,94 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ExportResponse struct {
+	Success bool       `json:"success"`
+	Data    ExportData `json:"data,omitempty"`
+}
+
+type ExportData struct {
+	Error string `json:"error,omitempty"`
+}
+
+// exportContentTypes are the content types of each export format
+var exportContentTypes = map[string]string{
+	"text":  "text/plain; charset=utf-8",
+	"csv":   "text/csv; charset=utf-8",
+	"jsonl": "application/x-ndjson",
+}
+
+// exportExtensions are the file extensions of each export format
+var exportExtensions = map[string]string{
+	"text":  "txt",
+	"csv":   "csv",
+	"jsonl": "jsonl",
+}
+
+var ExportFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can export stock
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, ExportResponse{Success: false, Data: ExportData{Error: keyError}}, "export")
+		return
+	}
+
+	query := request.URL.Query()
+	options := database.ExportOptions{
+		Pool:    query.Get("pool"),
+		Format:  query.Get("format"),
+		History: query.Get("history") == "true",
+		Remove:  query.Get("remove") == "true",
+	}
+	if batch := query.Get("batch"); batch != "" {
+		var err error
+		options.Batch, err = strconv.ParseInt(batch, 10, 64)
+		if err != nil || options.Batch < 1 {
+			writeJSON(writer, http.StatusBadRequest, ExportResponse{Success: false, Data: ExportData{Error: "invalid batch"}}, "export")
+			return
+		}
+	}
+	if options.Format == "" {
+		options.Format = "text"
+	}
+	if !database.IsValidExportFormat(options.Format) {
+		writeJSON(writer, http.StatusBadRequest, ExportResponse{Success: false, Data: ExportData{Error: "invalid format (" + strings.Join(database.ExportFormats, ", ") + ")"}}, "export")
+		return
+	}
+	// an empty pool exports every pool
+	if options.Pool != "" && !database.IsValidPoolName(options.Pool) {
+		writeJSON(writer, http.StatusBadRequest, ExportResponse{Success: false, Data: ExportData{Error: "invalid pool"}}, "export")
+		return
+	}
+	// removing stock changes the database so it can't be done by a GET
+	if options.Remove && request.Method != http.MethodPost {
+		writeJSON(writer, http.StatusMethodNotAllowed, ExportResponse{Success: false, Data: ExportData{Error: "remove has to be a POST request"}}, "export")
+		return
+	}
+
+	filename := "stock"
+	if options.Pool != "" {
+		filename += "-" + options.Pool
+	}
+	if options.Batch != 0 {
+		filename += "-batch" + strconv.FormatInt(options.Batch, 10)
+	}
+	writer.Header().Set("Content-Type", exportContentTypes[options.Format])
+	writer.Header().Set("Content-Disposition", `attachment; filename="`+filename+"."+exportExtensions[options.Format]+`"`)
+
+	// the export is streamed, once it started the status can't change anymore so failures are only logged.
+	// removed stock is kept if the export couldn't be fully written
+	exported, err := database.Connection.ExportStock(writer, options)
+	if err != nil {
+		log.Println("error exporting stock after", exported, "rows:", err)
+		return
+	}
+	log.Println(" [~] Exported", exported, "alts")
+}
@@ -3,9 +3,13 @@ package api
 import (
 	"DortgenAPI/src/database"
 	"encoding/json"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type GenerateResponse struct {
@@ -14,32 +18,40 @@ type GenerateResponse struct {
 }
 
 type GenerateData struct {
-	Error    string `json:"error,omitempty"`
-	Email    string `json:"email,omitempty"`
-	Password string `json:"password,omitempty"`
-	Combo    string `json:"combo,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Email    string         `json:"email,omitempty"`
+	Password string         `json:"password,omitempty"`
+	Combo    string         `json:"combo,omitempty"`
+	Items    []GenerateItem `json:"items,omitempty"`
+	Lease    string         `json:"lease,omitempty"`
+	Expires  int64          `json:"expires,omitempty"`
+}
+
+type GenerateItem struct {
+	Id       int    `json:"id,omitempty"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Combo    string `json:"combo"`
 }
 
 var (
 	CurrentRequests = map[string]struct{}{}
+	// DefaultMaxBatch is the max amount of alts per generate call for keys without their own limit
+	DefaultMaxBatch = 10
+	// LeaseTimeout is how long leased alts stay reserved before returning to stock
+	LeaseTimeout = time.Minute
+	// rateLimited counts generate calls turned away by a limit, by the limit they hit
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dortgen_rate_limited_total",
+		Help: "Generate requests rejected by a rate limit.",
+	}, []string{"reason"})
 )
 
 var GenerateFunc = func(writer http.ResponseWriter, request *http.Request) {
 	// check to see if they are already requesting an account
 	if isRequesting(request.RemoteAddr) {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: "already requesting",
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusTooManyRequests)
-		_, err = writer.Write(responsePayload)
+		rateLimited.WithLabelValues("concurrent").Inc()
+		writeJSON(writer, http.StatusTooManyRequests, GenerateResponse{Success: false, Data: GenerateData{Error: "already requesting"}}, "generate")
 		return
 	}
 	// add them to the list of current requests
@@ -51,95 +63,92 @@ var GenerateFunc = func(writer http.ResponseWriter, request *http.Request) {
 	// check if key is set
 	if key == "" {
 		// if not, return an error
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: "key not set",
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (key set):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusBadRequest)
-		_, err = writer.Write(responsePayload)
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "key not set"}}, "generate")
 		return
 	}
 
 	// validate the key
 	keyExists, err := database.Connection.DoesKeyExist(key)
 	if err != nil {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: err.Error(),
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (validate key):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusBadRequest)
-		_, err = writer.Write(responsePayload)
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: err.Error()}}, "generate")
 		return
 	}
 	if !keyExists {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: "invalid key",
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (invalid key):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusBadRequest)
-		_, err = writer.Write(responsePayload)
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "invalid key"}}, "generate")
 		return
 	}
 
 	// check to see if key is disabled
 	keyDisabled, err := database.Connection.IsKeyDisabled(key)
 	if err != nil {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: err.Error(),
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (check key disabled):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: err.Error()}}, "generate")
+		return
+	}
+	if keyDisabled {
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "key disabled"}}, "generate")
+		return
+	}
+
+	// get the pool to generate from and check the key is allowed to use it
+	pool, ok := parsePool(request.URL.Query().Get("pool"))
+	if !ok {
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "invalid pool"}}, "generate")
+		return
+	}
+	allowed, err := database.Connection.CanUsePool(key, pool)
+	if err != nil {
+		log.Println("error checking key pools:", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "key can not use pool " + pool}}, "generate")
+		return
+	}
+
+	// get the amount of alts to generate
+	count := 1
+	if countParam := request.URL.Query().Get("count"); countParam != "" {
+		count, err = strconv.Atoi(countParam)
+		if err != nil || count < 1 {
+			writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "invalid count"}}, "generate")
 			return
 		}
-		writer.WriteHeader(http.StatusBadRequest)
-		_, err = writer.Write(responsePayload)
+	}
+
+	// get the dispense mode, either all-or-nothing (default) or best-effort
+	mode := request.URL.Query().Get("mode")
+	if mode != "" && mode != "all" && mode != "best-effort" {
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "invalid mode (all, best-effort)"}}, "generate")
 		return
 	}
-	if keyDisabled {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: "key disabled",
-			},
+	allOrNothing := mode != "best-effort"
+
+	// check the count against the key's max batch size and quota
+	maxBatch, quota, uses, err := database.Connection.GetKeyLimits(key)
+	if err != nil {
+		log.Println("error getting key limits:", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if maxBatch <= 0 {
+		maxBatch = DefaultMaxBatch
+	}
+	if count > maxBatch {
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "count exceeds max batch size (" + strconv.Itoa(maxBatch) + ")"}}, "generate")
+		return
+	}
+	if quota > 0 && count > quota-uses {
+		remaining := quota - uses
+		if remaining < 0 {
+			remaining = 0
 		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (key disabled):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
+		if allOrNothing || remaining == 0 {
+			rateLimited.WithLabelValues("quota").Inc()
+			writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "quota exceeded (" + strconv.Itoa(remaining) + " remaining)"}}, "generate")
 			return
 		}
-		writer.WriteHeader(http.StatusBadRequest)
-		_, err = writer.Write(responsePayload)
-		return
+		count = remaining
 	}
 
 	// check to see if cooldown is over
@@ -151,25 +160,13 @@ var GenerateFunc = func(writer http.ResponseWriter, request *http.Request) {
 	}
 
 	if cooldown > 0 {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: "cooldown not over (" + strconv.Itoa(cooldown) + "s)",
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (cooldown not over):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusBadRequest)
-		_, err = writer.Write(responsePayload)
+		rateLimited.WithLabelValues("cooldown").Inc()
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: "cooldown not over (" + strconv.Itoa(cooldown) + "s)"}}, "generate")
 		return
 	}
 
 	// check to see if there is stock
-	stock, err := database.Connection.GetStockAmount()
+	stock, err := database.Connection.GetPoolStockAmount(pool)
 	if err != nil {
 		log.Println("error getting stock amount:", err)
 		writer.WriteHeader(http.StatusInternalServerError)
@@ -177,68 +174,90 @@ var GenerateFunc = func(writer http.ResponseWriter, request *http.Request) {
 	}
 
 	if stock <= 0 {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: "out of stock",
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (out of stock):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusOK)
-		_, err = writer.Write(responsePayload)
+		writeJSON(writer, http.StatusOK, GenerateResponse{Success: false, Data: GenerateData{Error: "out of stock"}}, "generate")
 		return
 	}
 
-	// generate the account
-	alt, err := database.Connection.GetAltAndRemoveFromStock()
+	// generate the accounts, only reserving them under a lease if requested
+	leased := request.URL.Query().Get("lease") == "true"
+	var alts []database.Alt
+	var leaseId string
+	var leaseExpires int64
+	if leased {
+		leaseId, leaseExpires, alts, err = database.Connection.LeaseAlts(key, pool, count, allOrNothing, LeaseTimeout)
+	} else {
+		alts, err = database.Connection.DispenseAlts(key, pool, count, allOrNothing)
+	}
+	if errors.Is(err, database.ErrNotEnoughStock) {
+		writeJSON(writer, http.StatusOK, GenerateResponse{Success: false, Data: GenerateData{Error: "not enough stock (" + strconv.Itoa(stock) + " available)"}}, "generate")
+		return
+	}
+	// another request of the key can use up its cooldown or quota after the checks above
+	var limit *database.LimitError
+	if errors.As(err, &limit) {
+		rateLimited.WithLabelValues(limit.Limit).Inc()
+		writeJSON(writer, http.StatusBadRequest, GenerateResponse{Success: false, Data: GenerateData{Error: limit.Error()}}, "generate")
+		return
+	}
 	if err != nil {
-		response := GenerateResponse{
-			Success: false,
-			Data: GenerateData{
-				Error: err.Error(),
-			},
-		}
-		responsePayload, err := json.Marshal(response)
-		if err != nil {
-			log.Println("error marshalling generate response (get alt):", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		writer.WriteHeader(http.StatusInternalServerError)
-		_, err = writer.Write(responsePayload)
+		writeJSON(writer, http.StatusInternalServerError, GenerateResponse{Success: false, Data: GenerateData{Error: err.Error()}}, "generate")
 		return
 	}
 
-	// return the account
+	// return the accounts
 	response := GenerateResponse{
 		Success: true,
 		Data: GenerateData{
+			Lease:   leaseId,
+			Expires: leaseExpires,
+		},
+	}
+	for _, alt := range alts {
+		response.Data.Items = append(response.Data.Items, GenerateItem{
+			Id:       alt.DispenseId,
 			Email:    alt.Email,
 			Password: alt.Password,
 			Combo:    alt.Email + ":" + alt.Password,
-		},
+		})
+	}
+	// single alt responses keep the flat email/password/combo fields
+	if len(alts) == 1 {
+		response.Data.Email = alts[0].Email
+		response.Data.Password = alts[0].Password
+		response.Data.Combo = alts[0].Email + ":" + alts[0].Password
 	}
 	responsePayload, err := json.Marshal(response)
 	if err != nil {
 		log.Println("error marshalling generate response (alt response):", err)
 		writer.WriteHeader(http.StatusInternalServerError)
-		err = database.Connection.AddAltToStock(alt.Email, alt.Password)
-		if err != nil {
-			log.Println("error adding alt back to stock:", err)
-		}
+		returnAlts(key, alts, leased)
 		return
 	}
+	writer.Header().Set("Content-Type", "application/json")
 	writer.WriteHeader(http.StatusOK)
 	_, err = writer.Write(responsePayload)
+	if err != nil {
+		log.Println("error writing generate response:", err)
+		returnAlts(key, alts, leased)
+		return
+	}
+	// the dispense is only counted and announced once the alts reached the client, leased alts once they are confirmed
+	if !leased {
+		database.Connection.DeliveredAlts(key, alts)
+	}
+}
 
-	// set cooldown for the key
-	err = database.Connection.SetCooldown(key)
-
+/*
+returnAlts ~ takes back alts that never reached the client, leased alts return on their own when the lease expires
+*/
+func returnAlts(key string, alts []database.Alt, leased bool) {
+	if leased {
+		return
+	}
+	err := database.Connection.UndoDispense(key, alts)
+	if err != nil {
+		log.Println("error taking back dispensed alts:", err)
+	}
 }
 
 func addRequest(ip string) {
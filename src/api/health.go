@@ -0,0 +1,77 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"context"
+	"net/http"
+	"time"
+)
+
+// ReadyTimeout is how long the readiness checks together may take before the server counts as not ready
+var ReadyTimeout = 2 * time.Second
+
+type HealthResponse struct {
+	Success bool       `json:"success"`
+	Data    HealthData `json:"data"`
+}
+
+type HealthData struct {
+	Status string `json:"status"`
+	// Checks are only set on the readiness check, one per dependency
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_ms"`
+	Error    string  `json:"error,omitempty"`
+}
+
+/*
+runCheck ~ runs a single readiness check and times it
+*/
+func runCheck(check func() error) HealthCheck {
+	start := time.Now()
+	err := check()
+	result := HealthCheck{Status: "ok", Duration: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HealthzFunc only tells if the process is alive and serving, it doesn't touch the database
+var HealthzFunc = func(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, HealthResponse{Success: true, Data: HealthData{Status: "ok"}}, "healthz")
+}
+
+// ReadyzFunc tells if the server can serve requests, it fails with 503 if any dependency isn't usable
+var ReadyzFunc = func(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), ReadyTimeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{}
+	checks["database"] = runCheck(func() error {
+		return database.Connection.Ping(ctx)
+	})
+	// the schema can't be checked without a database
+	if checks["database"].Status == "ok" {
+		checks["migrations"] = runCheck(database.Connection.CheckMigrations)
+	} else {
+		checks["migrations"] = HealthCheck{Status: "skipped"}
+	}
+	checks["data_folder"] = runCheck(database.CheckDataFolder)
+
+	response := HealthResponse{Success: true, Data: HealthData{Status: "ok", Checks: checks}}
+	status := http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			response.Success = false
+			response.Data.Status = "failed"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writer.Header().Set("Cache-Control", "no-store")
+	writeJSON(writer, status, response, "readyz")
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+type JobsResponse struct {
+	Success bool     `json:"success"`
+	Data    JobsData `json:"data,omitempty"`
+}
+
+type JobsData struct {
+	Error string         `json:"error,omitempty"`
+	Job   *database.Job  `json:"job,omitempty"`
+	Jobs  []database.Job `json:"jobs,omitempty"`
+}
+
+var JobsFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see import jobs
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, JobsResponse{Success: false, Data: JobsData{Error: keyError}}, "jobs")
+		return
+	}
+
+	jobs, err := database.Connection.GetJobs(50)
+	if err != nil {
+		log.Println("error getting jobs:", err)
+		writeJSON(writer, http.StatusInternalServerError, JobsResponse{Success: false, Data: JobsData{Error: err.Error()}}, "jobs")
+		return
+	}
+	writeJSON(writer, http.StatusOK, JobsResponse{Success: true, Data: JobsData{Jobs: jobs}}, "jobs")
+}
+
+var JobFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see import jobs
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, JobsResponse{Success: false, Data: JobsData{Error: keyError}}, "job")
+		return
+	}
+
+	job, err := database.Connection.GetJob(chi.URLParam(request, "id"))
+	if errors.Is(err, database.ErrJobNotFound) {
+		writeJSON(writer, http.StatusNotFound, JobsResponse{Success: false, Data: JobsData{Error: err.Error()}}, "job")
+		return
+	}
+	if err != nil {
+		log.Println("error getting job:", err)
+		writeJSON(writer, http.StatusInternalServerError, JobsResponse{Success: false, Data: JobsData{Error: err.Error()}}, "job")
+		return
+	}
+	writeJSON(writer, http.StatusOK, JobsResponse{Success: true, Data: JobsData{Job: job}}, "job")
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+type KeyStateResponse struct {
+	Success bool         `json:"success"`
+	Data    KeyStateData `json:"data,omitempty"`
+}
+
+type KeyStateData struct {
+	Error string `json:"error,omitempty"`
+}
+
+/*
+setKeyDisabled ~ builds the handler that disables or enables the key of the owner in the url
+*/
+func setKeyDisabled(disabled bool, context string) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		// only admins can disable and enable keys
+		status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+		if keyError != "" {
+			writeJSON(writer, status, KeyStateResponse{Success: false, Data: KeyStateData{Error: keyError}}, context)
+			return
+		}
+
+		owner := chi.URLParam(request, "owner")
+		err := database.Connection.SetKeyDisabled(owner, disabled)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			writeJSON(writer, http.StatusNotFound, KeyStateResponse{Success: false, Data: KeyStateData{Error: err.Error()}}, context)
+			return
+		}
+		if errors.Is(err, database.ErrAdminKey) {
+			writeJSON(writer, http.StatusBadRequest, KeyStateResponse{Success: false, Data: KeyStateData{Error: err.Error()}}, context)
+			return
+		}
+		if err != nil {
+			log.Println("error changing key state:", err)
+			writeJSON(writer, http.StatusInternalServerError, KeyStateResponse{Success: false, Data: KeyStateData{Error: err.Error()}}, context)
+			return
+		}
+		writeJSON(writer, http.StatusOK, KeyStateResponse{Success: true}, context)
+	}
+}
+
+var DisableKeyFunc = setKeyDisabled(true, "disable key")
+
+var EnableKeyFunc = setKeyDisabled(false, "enable key")
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+type PoolsResponse struct {
+	Success bool      `json:"success"`
+	Data    PoolsData `json:"data,omitempty"`
+}
+
+type PoolsData struct {
+	Error string          `json:"error,omitempty"`
+	Pools []database.Pool `json:"pools,omitempty"`
+}
+
+// UpdatePoolRequest holds the pool settings to change, unset fields are left as they are
+type UpdatePoolRequest struct {
+	Strategy    *string `json:"strategy"`
+	EmailCheck  *bool   `json:"email_check"`
+	MinLength   *int    `json:"min_length"`
+	MaxLength   *int    `json:"max_length"`
+	Charset     *string `json:"charset"`
+	Pattern     *string `json:"pattern"`
+	LowStock    *int    `json:"low_stock"`
+	AlertURL    *string `json:"alert_url"`
+	AlertFormat *string `json:"alert_format"`
+}
+
+var PoolsFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see pool settings
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, PoolsResponse{Success: false, Data: PoolsData{Error: keyError}}, "pools")
+		return
+	}
+
+	pools, err := database.Connection.GetPools()
+	if err != nil {
+		log.Println("error getting pools:", err)
+		writeJSON(writer, http.StatusInternalServerError, PoolsResponse{Success: false, Data: PoolsData{Error: err.Error()}}, "pools")
+		return
+	}
+	writeJSON(writer, http.StatusOK, PoolsResponse{Success: true, Data: PoolsData{Pools: pools}}, "pools")
+}
+
+var UpdatePoolFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can change pool settings
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, PoolsResponse{Success: false, Data: PoolsData{Error: keyError}}, "update pool")
+		return
+	}
+
+	pool, ok := parsePool(chi.URLParam(request, "pool"))
+	if !ok {
+		writeJSON(writer, http.StatusBadRequest, PoolsResponse{Success: false, Data: PoolsData{Error: "invalid pool"}}, "update pool")
+		return
+	}
+
+	var requestData UpdatePoolRequest
+	err := json.NewDecoder(request.Body).Decode(&requestData)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, PoolsResponse{Success: false, Data: PoolsData{Error: err.Error()}}, "update pool")
+		return
+	}
+
+	// apply the changes on top of the current settings
+	settings, err := database.Connection.GetPool(pool)
+	if err != nil {
+		log.Println("error getting pool:", err)
+		writeJSON(writer, http.StatusInternalServerError, PoolsResponse{Success: false, Data: PoolsData{Error: err.Error()}}, "update pool")
+		return
+	}
+	if requestData.Strategy != nil {
+		settings.Strategy = *requestData.Strategy
+	}
+	if requestData.EmailCheck != nil {
+		settings.EmailCheck = *requestData.EmailCheck
+	}
+	if requestData.MinLength != nil {
+		settings.MinLength = *requestData.MinLength
+	}
+	if requestData.MaxLength != nil {
+		settings.MaxLength = *requestData.MaxLength
+	}
+	if requestData.Charset != nil {
+		settings.Charset = *requestData.Charset
+	}
+	if requestData.Pattern != nil {
+		settings.Pattern = *requestData.Pattern
+	}
+	if requestData.LowStock != nil {
+		settings.LowStock = *requestData.LowStock
+	}
+	if requestData.AlertURL != nil {
+		settings.AlertURL = *requestData.AlertURL
+	}
+	if requestData.AlertFormat != nil {
+		settings.AlertFormat = *requestData.AlertFormat
+	}
+
+	if !database.IsValidStrategy(settings.Strategy) {
+		writeJSON(writer, http.StatusBadRequest, PoolsResponse{Success: false, Data: PoolsData{Error: "invalid strategy (fifo, lifo, random, priority)"}}, "update pool")
+		return
+	}
+	err = database.ValidatePool(settings)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, PoolsResponse{Success: false, Data: PoolsData{Error: err.Error()}}, "update pool")
+		return
+	}
+
+	err = database.Connection.SavePool(settings)
+	if err != nil {
+		log.Println("error saving pool:", err)
+		writeJSON(writer, http.StatusInternalServerError, PoolsResponse{Success: false, Data: PoolsData{Error: err.Error()}}, "update pool")
+		return
+	}
+	writeJSON(writer, http.StatusOK, PoolsResponse{Success: true, Data: PoolsData{Pools: []database.Pool{settings}}}, "update pool")
+}
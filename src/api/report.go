@@ -0,0 +1,132 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+type ReportResponse struct {
+	Success bool       `json:"success"`
+	Data    ReportData `json:"data,omitempty"`
+}
+
+type ReportData struct {
+	Error            string        `json:"error,omitempty"`
+	Report           int           `json:"report,omitempty"`
+	Replacement      *GenerateItem `json:"replacement,omitempty"`
+	ReplacementError string        `json:"replacement_error,omitempty"`
+}
+
+type ReportRequest struct {
+	DispenseId int    `json:"dispense_id"`
+	Reason     string `json:"reason"`
+	Replace    bool   `json:"replace"`
+}
+
+var (
+	// ReplaceWindow is how long after a dispense a replacement can still be requested
+	ReplaceWindow = time.Hour
+	// ReplaceLimit is how many replacements a key can receive per day, for keys without their own limit
+	ReplaceLimit = 3
+)
+
+var ReportFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// check the key is usable
+	key := request.URL.Query().Get("key")
+	status, keyError := authorizeKey(key, false)
+	if keyError != "" {
+		writeJSON(writer, status, ReportResponse{Success: false, Data: ReportData{Error: keyError}}, "report")
+		return
+	}
+
+	// get the report from post data
+	var requestData ReportRequest
+	err := json.NewDecoder(request.Body).Decode(&requestData)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, ReportResponse{Success: false, Data: ReportData{Error: err.Error()}}, "report")
+		return
+	}
+	if requestData.DispenseId <= 0 || requestData.Reason == "" {
+		writeJSON(writer, http.StatusBadRequest, ReportResponse{Success: false, Data: ReportData{Error: "dispense_id or reason not set"}}, "report")
+		return
+	}
+
+	// the dispensed alt has to belong to the key
+	dispense, err := database.Connection.GetDispense(key, requestData.DispenseId)
+	if errors.Is(err, database.ErrDispenseNotFound) {
+		writeJSON(writer, http.StatusNotFound, ReportResponse{Success: false, Data: ReportData{Error: err.Error()}}, "report")
+		return
+	}
+	if err != nil {
+		log.Println("error getting dispense:", err)
+		writeJSON(writer, http.StatusInternalServerError, ReportResponse{Success: false, Data: ReportData{Error: err.Error()}}, "report")
+		return
+	}
+
+	// record the report, a dispense that was reported before can still ask for the replacement it didn't get
+	reportId, err := database.Connection.CreateReport(key, dispense.Id, requestData.Reason)
+	if errors.Is(err, database.ErrAlreadyReported) && requestData.Replace {
+		reportId, err = database.Connection.GetUnreplacedReport(key, dispense.Id)
+		if errors.Is(err, database.ErrReportNotFound) {
+			err = database.ErrAlreadyReported
+		}
+	} else if err == nil {
+		log.Println(" [!] Dispense", dispense.Id, "reported:", requestData.Reason)
+	}
+	if errors.Is(err, database.ErrAlreadyReported) || errors.Is(err, database.ErrAlreadyReplaced) {
+		writeJSON(writer, http.StatusBadRequest, ReportResponse{Success: false, Data: ReportData{Error: err.Error()}}, "report")
+		return
+	}
+	if err != nil {
+		log.Println("error creating report:", err)
+		writeJSON(writer, http.StatusInternalServerError, ReportResponse{Success: false, Data: ReportData{Error: err.Error()}}, "report")
+		return
+	}
+
+	response := ReportResponse{
+		Success: true,
+		Data: ReportData{
+			Report: reportId,
+		},
+	}
+	if requestData.Replace {
+		response.Data.Replacement, response.Data.ReplacementError = replaceDispense(key, dispense, reportId)
+	}
+	writeJSON(writer, http.StatusOK, response, "report")
+}
+
+/*
+replaceDispense ~ gives the key a replacement for a reported dispense if it is within the replacement window and limit
+*/
+func replaceDispense(key string, dispense *database.Dispense, reportId int) (*GenerateItem, string) {
+	if time.Since(time.Unix(dispense.Dispensed, 0)) > ReplaceWindow {
+		return nil, "replacement window expired"
+	}
+
+	alt, err := database.Connection.DispenseReplacement(key, dispense.Pool, reportId, ReplaceLimit)
+	if errors.Is(err, database.ErrNotEnoughStock) {
+		return nil, "out of stock"
+	}
+	if errors.Is(err, database.ErrPoolNotAllowed) {
+		return nil, "key can not use pool " + dispense.Pool
+	}
+	var limit *database.ReplacementLimitError
+	if errors.Is(err, database.ErrKeyDisabled) || errors.Is(err, database.ErrAlreadyReplaced) || errors.As(err, &limit) {
+		return nil, err.Error()
+	}
+	if err != nil {
+		log.Println("error dispensing replacement:", err)
+		return nil, err.Error()
+	}
+	return &GenerateItem{
+		Id:       alt.DispenseId,
+		Email:    alt.Email,
+		Password: alt.Password,
+		Combo:    alt.Email + ":" + alt.Password,
+	}, ""
+}
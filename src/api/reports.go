@@ -0,0 +1,91 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type ReportsResponse struct {
+	Success bool        `json:"success"`
+	Data    ReportsData `json:"data,omitempty"`
+}
+
+type ReportsData struct {
+	Error   string            `json:"error,omitempty"`
+	Reports []database.Report `json:"reports,omitempty"`
+}
+
+type ReviewReportRequest struct {
+	Status string `json:"status"`
+}
+
+var ReportsFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see the report queue
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, ReportsResponse{Success: false, Data: ReportsData{Error: keyError}}, "reports")
+		return
+	}
+
+	// defaults to the open reports that still need reviewing
+	reportStatus := request.URL.Query().Get("status")
+	if reportStatus == "" {
+		reportStatus = "open"
+	}
+	if reportStatus == "all" {
+		reportStatus = ""
+	}
+
+	reports, err := database.Connection.GetReports(reportStatus)
+	if err != nil {
+		log.Println("error getting reports:", err)
+		writeJSON(writer, http.StatusInternalServerError, ReportsResponse{Success: false, Data: ReportsData{Error: err.Error()}}, "reports")
+		return
+	}
+	writeJSON(writer, http.StatusOK, ReportsResponse{Success: true, Data: ReportsData{Reports: reports}}, "reports")
+}
+
+var ReviewReportFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can review reports
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, ReportsResponse{Success: false, Data: ReportsData{Error: keyError}}, "review report")
+		return
+	}
+
+	reportId, err := strconv.Atoi(chi.URLParam(request, "id"))
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, ReportsResponse{Success: false, Data: ReportsData{Error: "invalid report id"}}, "review report")
+		return
+	}
+
+	var requestData ReviewReportRequest
+	err = json.NewDecoder(request.Body).Decode(&requestData)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, ReportsResponse{Success: false, Data: ReportsData{Error: err.Error()}}, "review report")
+		return
+	}
+	if requestData.Status != "open" && requestData.Status != "resolved" && requestData.Status != "rejected" {
+		writeJSON(writer, http.StatusBadRequest, ReportsResponse{Success: false, Data: ReportsData{Error: "invalid status (open, resolved, rejected)"}}, "review report")
+		return
+	}
+
+	err = database.Connection.ReviewReport(reportId, requestData.Status)
+	if errors.Is(err, database.ErrReportNotFound) {
+		writeJSON(writer, http.StatusNotFound, ReportsResponse{Success: false, Data: ReportsData{Error: err.Error()}}, "review report")
+		return
+	}
+	if err != nil {
+		log.Println("error reviewing report:", err)
+		writeJSON(writer, http.StatusInternalServerError, ReportsResponse{Success: false, Data: ReportsData{Error: err.Error()}}, "review report")
+		return
+	}
+	writeJSON(writer, http.StatusOK, ReportsResponse{Success: true}, "review report")
+}
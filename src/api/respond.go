@@ -0,0 +1,77 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+/*
+writeJSON ~ marshals the response and writes it with the status code, logging any errors under the given context
+*/
+func writeJSON(writer http.ResponseWriter, status int, response any, context string) {
+	responsePayload, err := json.Marshal(response)
+	if err != nil {
+		log.Println("error marshalling "+context+" response:", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_, err = writer.Write(responsePayload)
+	if err != nil {
+		log.Println("error writing "+context+" response:", err)
+	}
+}
+
+/*
+authorizeKey ~ checks the key exists and is not disabled, and that it belongs to the admin if requireAdmin is set.
+Returns the status code and error to respond with, the error is empty if the key is authorized.
+*/
+func authorizeKey(key string, requireAdmin bool) (int, string) {
+	if key == "" {
+		return http.StatusBadRequest, "key not set"
+	}
+
+	valid, err := database.Connection.DoesKeyExist(key)
+	if err != nil {
+		log.Println("error validating key:", err)
+		return http.StatusInternalServerError, err.Error()
+	}
+	if !valid {
+		return http.StatusBadRequest, "invalid key"
+	}
+
+	disabled, err := database.Connection.IsKeyDisabled(key)
+	if err != nil {
+		log.Println("error checking if key is disabled:", err)
+		return http.StatusInternalServerError, err.Error()
+	}
+	if disabled {
+		return http.StatusBadRequest, "key disabled"
+	}
+
+	if requireAdmin {
+		owner, err := database.Connection.GetOwnerFromKey(key)
+		if err != nil {
+			log.Println("error getting key owner:", err)
+			return http.StatusInternalServerError, err.Error()
+		}
+		if owner != "admin" {
+			return http.StatusBadRequest, "key is not admin"
+		}
+	}
+
+	return http.StatusOK, ""
+}
+
+/*
+parsePool ~ checks the name of a pool, an empty name is the default pool. Returns false if the name is invalid
+*/
+func parsePool(pool string) (string, bool) {
+	if pool == "" {
+		return "default", true
+	}
+	return pool, database.IsValidPoolName(pool)
+}
@@ -3,16 +3,25 @@ package api
 import (
 	"DortgenAPI/src/database"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
-	"mime/multipart"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type RestockResponse struct {
-	Succes  bool   `json:"success"`
-	Message string `json:"message,omitempty"`
+	Succes  bool                    `json:"success"`
+	Message string                  `json:"message,omitempty"`
+	Report  *database.RestockReport `json:"report,omitempty"`
+	Job     string                  `json:"job,omitempty"`
 }
 
+// restockMemoryLimit is how much of a restock upload is kept in memory before it is written to disk
+const restockMemoryLimit = 1 << 20
+
 var RestockFunc = func(writer http.ResponseWriter, request *http.Request) {
 
 	// get the key from query string
@@ -142,17 +151,16 @@ var RestockFunc = func(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// parse the form
-	err = request.ParseMultipartForm(32 << 20)
-	if err != nil {
-		log.Println("error parsing multipart form:", err)
+	// get the items to restock, either from an uploaded file or straight from the body
+	source, format, sourceName, sourceError := restockSource(request)
+	if sourceError != "" {
 		response := RestockResponse{
 			Succes:  false,
-			Message: "error parsing multipart form",
+			Message: sourceError,
 		}
 		responsePayload, err := json.Marshal(response)
 		if err != nil {
-			log.Println("error marshalling restock response (parse form):", err)
+			log.Println("error marshalling restock response (read items):", err)
 			writer.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -160,60 +168,130 @@ var RestockFunc = func(writer http.ResponseWriter, request *http.Request) {
 		_, err = writer.Write(responsePayload)
 		return
 	}
+	defer func(source io.ReadCloser) {
+		_ = source.Close()
+	}(source)
 
-	// check if a file was sent
-	if request.MultipartForm == nil {
+	// a raw body is the items themselves so its options can only be in the query, reading them from the form
+	// would parse a form-urlencoded body and leave nothing to import
+	param := request.URL.Query().Get
+	if request.MultipartForm != nil {
+		param = request.FormValue
+	}
+
+	// get the pool to restock
+	pool, ok := parsePool(param("pool"))
+	if !ok {
 		response := RestockResponse{
 			Succes:  false,
-			Message: "no file sent",
+			Message: "invalid pool",
 		}
 		responsePayload, err := json.Marshal(response)
 		if err != nil {
-			log.Println("error marshalling restock response (no file sent):", err)
+			log.Println("error marshalling restock response (invalid pool):", err)
 			writer.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		writer.WriteHeader(http.StatusBadRequest)
 		_, err = writer.Write(responsePayload)
+		return
+	}
+
+	// get the priority of the alts for the priority dispense strategy
+	priority := 0
+	if priorityParam := param("priority"); priorityParam != "" {
+		priority, err = strconv.Atoi(priorityParam)
 		if err != nil {
-			log.Println("error writing restock response:", err)
+			response := RestockResponse{
+				Succes:  false,
+				Message: "invalid priority",
+			}
+			responsePayload, err := json.Marshal(response)
+			if err != nil {
+				log.Println("error marshalling restock response (invalid priority):", err)
+				writer.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writer.WriteHeader(http.StatusBadRequest)
+			_, err = writer.Write(responsePayload)
 			return
 		}
-		return
 	}
 
-	// read the file sent in the request
-	file, fileHeader, err := request.FormFile("altfile")
-	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
+	options := database.ImportOptions{
+		Pool:     pool,
+		Priority: priority,
+		Key:      key,
+		Source:   sourceName,
+		Format:   format,
+		Atomic:   param("atomic") == "true",
+		Details:  param("details") == "true",
+		DryRun:   param("dry_run") == "true",
+		// alts imported or dispensed before are only restocked when asked to
+		AllowRestock: param("allow_restock") == "true",
+	}
+
+	// large imports can run in the background, the job is polled through /admin/jobs/{id}
+	if param("async") == "true" {
+		jobId, err := database.Connection.StartImportJob(key, source, options)
+		if err != nil {
+			log.Println("error starting import job:", err)
+			response := RestockResponse{
+				Succes:  false,
+				Message: "error starting import job",
+			}
+			responsePayload, err := json.Marshal(response)
+			if err != nil {
+				log.Println("error marshalling restock response (start job):", err)
+				writer.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, err = writer.Write(responsePayload)
+			return
+		}
 		response := RestockResponse{
-			Succes:  false,
-			Message: "error reading file",
+			Succes: true,
+			Job:    jobId,
 		}
 		responsePayload, err := json.Marshal(response)
 		if err != nil {
-			log.Println("error marshalling restock response (error reading file):", err)
+			log.Println("error marshalling restock response (job started):", err)
 			writer.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		writer.WriteHeader(http.StatusAccepted)
 		_, err = writer.Write(responsePayload)
+		return
+	}
+
+	// add the accounts to the database, after the import jobs that are running
+	report, err := database.Connection.ImportAccounts(source, options)
+	var formatError *database.FormatError
+	if errors.As(err, &formatError) {
+		// alts of batches committed before the import failed stay in stock, the report tells how many
+		response := RestockResponse{
+			Succes:  false,
+			Message: formatError.Error(),
+			Report:  report,
+		}
+		responsePayload, err := json.Marshal(response)
 		if err != nil {
-			log.Println("error writing restock response:", err)
+			log.Println("error marshalling restock response (unreadable file):", err)
+			writer.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		writer.WriteHeader(http.StatusBadRequest)
+		_, err = writer.Write(responsePayload)
 		return
 	}
-	defer func(file multipart.File) {
-		_ = file.Close()
-	}(file)
-
-	// add the accounts to the database
-	response, err := database.Connection.AddAccountsFromFile(file, fileHeader.Size)
 	if err != nil {
+		log.Println("error adding accounts to database:", err)
 		writer.WriteHeader(http.StatusInternalServerError)
 		response := RestockResponse{
 			Succes:  false,
 			Message: "error adding accounts to database",
+			Report:  report,
 		}
 		responsePayload, err := json.Marshal(response)
 		if err != nil {
@@ -231,8 +309,8 @@ var RestockFunc = func(writer http.ResponseWriter, request *http.Request) {
 
 	// return a success response
 	restockResponse := RestockResponse{
-		Succes:  true,
-		Message: response,
+		Succes: true,
+		Report: report,
 	}
 	responsePayload, err := json.Marshal(restockResponse)
 	if err != nil {
@@ -247,3 +325,52 @@ var RestockFunc = func(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 }
+
+/*
+restockSource ~ gets the items of a restock request, from the altfile of a multipart upload or otherwise the raw body.
+JSON bodies hold an items array, any other body is read in the format param or the format of its content type.
+Form-urlencoded bodies, which curl sends by default, are read as text like any other body.
+Returns the items, their format, the name of the file they came from and the error to respond with if they can't be read
+*/
+func restockSource(request *http.Request) (io.ReadCloser, string, string, string) {
+	contentType := request.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	format := request.URL.Query().Get("format")
+
+	if mediaType != "multipart/form-data" {
+		if format == "" && mediaType == "application/json" {
+			format = database.ItemsFormat
+		}
+		if format == "" {
+			format = database.DetectFormat(contentType, "")
+		}
+		if format != database.ItemsFormat && !database.IsValidFormat(format) {
+			return nil, "", "", "invalid format (" + strings.Join(database.ImportFormats, ", ") + ")"
+		}
+		return request.Body, format, "", ""
+	}
+
+	// parse the form, anything past the memory limit is spooled to a temp file so large uploads don't fill memory
+	err := request.ParseMultipartForm(restockMemoryLimit)
+	if err != nil {
+		log.Println("error parsing multipart form:", err)
+		return nil, "", "", "error parsing multipart form"
+	}
+
+	// read the file sent in the request
+	file, fileHeader, err := request.FormFile("altfile")
+	if err != nil {
+		return nil, "", "", "no file sent"
+	}
+
+	// get the format of the file, guessing it from the upload when it isn't set
+	format = request.FormValue("format")
+	if format == "" {
+		format = database.DetectFormat(fileHeader.Header.Get("Content-Type"), fileHeader.Filename)
+	}
+	if !database.IsValidFormat(format) {
+		_ = file.Close()
+		return nil, "", "", "invalid format (" + strings.Join(database.ImportFormats, ", ") + ")"
+	}
+	return file, format, fileHeader.Filename, ""
+}
@@ -5,10 +5,40 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 )
 
+// Version is the version of the server, shown to admins on /status
+var Version = "dev"
+
+// StartTime is when the server started, used for its uptime
+var StartTime = time.Now()
+
 type StatusResponse struct {
-	Stock int `json:"stock"`
+	Stock  int            `json:"stock"`
+	Pools  map[string]int `json:"pools"`
+	Uptime int64          `json:"uptime"`
+	Error  string         `json:"error,omitempty"`
+	// Admin is only filled in when the status is requested with an admin key
+	Admin *AdminStatus `json:"admin,omitempty"`
+}
+
+type AdminStatus struct {
+	Version       string  `json:"version"`
+	DispensedHour int     `json:"dispensed_last_hour"`
+	DispensedDay  int     `json:"dispensed_last_day"`
+	RatePerHour   float64 `json:"dispense_rate_per_hour"`
+	// RunsOutIn is the estimated seconds until stock runs out at the rate of the last day, unset if nothing was dispensed
+	RunsOutIn  *int64                `json:"runs_out_in,omitempty"`
+	ActiveKeys int                   `json:"active_keys"`
+	Keys       int                   `json:"keys"`
+	Pools      map[string]PoolStatus `json:"pools"`
+}
+
+type PoolStatus struct {
+	Stock        int    `json:"stock"`
+	DispensedDay int    `json:"dispensed_last_day"`
+	RunsOutIn    *int64 `json:"runs_out_in,omitempty"`
 }
 
 var StatusFunc = func(writer http.ResponseWriter, request *http.Request) {
@@ -17,12 +47,37 @@ var StatusFunc = func(writer http.ResponseWriter, request *http.Request) {
 	stock, err := database.Connection.GetStockAmount()
 	if err != nil {
 		log.Println("Error getting stock amount: " + err.Error())
-		writer.WriteHeader(http.StatusInternalServerError)
+		writeJSON(writer, http.StatusInternalServerError, StatusResponse{Error: "database error"}, "status")
+		return
+	}
+
+	pools, err := database.Connection.GetStockPerPool()
+	if err != nil {
+		log.Println("Error getting pool stock amounts: " + err.Error())
+		writeJSON(writer, http.StatusInternalServerError, StatusResponse{Error: "database error"}, "status")
 		return
 	}
 
 	response := StatusResponse{
-		Stock: stock,
+		Stock:  stock,
+		Pools:  pools,
+		Uptime: int64(time.Since(StartTime).Seconds()),
+	}
+
+	// statistics about dispenses and keys are only shown to admins
+	if key := request.URL.Query().Get("key"); key != "" {
+		status, keyError := authorizeKey(key, true)
+		if keyError != "" {
+			response.Error = keyError
+			writeJSON(writer, status, response, "status")
+			return
+		}
+		response.Admin, err = adminStatus(stock, pools)
+		if err != nil {
+			log.Println("Error getting admin status: " + err.Error())
+			writeJSON(writer, http.StatusInternalServerError, StatusResponse{Error: "database error"}, "status")
+			return
+		}
 	}
 
 	responsePayload, err := json.Marshal(response)
@@ -37,3 +92,64 @@ var StatusFunc = func(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 }
+
+/*
+adminStatus ~ gets the dispense and key statistics of the server, with the dispense rate of the last day
+used to estimate when the stock of each pool runs out
+*/
+func adminStatus(stock int, pools map[string]int) (*AdminStatus, error) {
+	now := time.Now()
+	lastHour, err := database.Connection.GetDispensedPerPool(now.Add(-time.Hour).Unix())
+	if err != nil {
+		return nil, err
+	}
+	lastDay, err := database.Connection.GetDispensedPerPool(now.Add(-24 * time.Hour).Unix())
+	if err != nil {
+		return nil, err
+	}
+	activeKeys, err := database.Connection.CountActiveKeys(now.Add(-24 * time.Hour).Unix())
+	if err != nil {
+		return nil, err
+	}
+	keys, err := database.Connection.CountKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &AdminStatus{
+		Version:    Version,
+		ActiveKeys: activeKeys,
+		Keys:       keys,
+		Pools:      map[string]PoolStatus{},
+	}
+	for _, dispensed := range lastHour {
+		status.DispensedHour += dispensed
+	}
+	for _, dispensed := range lastDay {
+		status.DispensedDay += dispensed
+	}
+	status.RatePerHour = float64(status.DispensedDay) / 24
+	status.RunsOutIn = runsOutIn(stock, status.DispensedDay)
+
+	// pools that only dispensed and ran out are listed too
+	for pool, dispensed := range lastDay {
+		if _, ok := pools[pool]; !ok {
+			status.Pools[pool] = PoolStatus{DispensedDay: dispensed, RunsOutIn: runsOutIn(0, dispensed)}
+		}
+	}
+	for pool, poolStock := range pools {
+		status.Pools[pool] = PoolStatus{Stock: poolStock, DispensedDay: lastDay[pool], RunsOutIn: runsOutIn(poolStock, lastDay[pool])}
+	}
+	return status, nil
+}
+
+/*
+runsOutIn ~ estimates the seconds until the stock runs out when it keeps being dispensed like the last day, nil if nothing was dispensed
+*/
+func runsOutIn(stock int, dispensedDay int) *int64 {
+	if dispensedDay == 0 {
+		return nil
+	}
+	seconds := int64(stock) * int64((24 * time.Hour).Seconds()) / int64(dispensedDay)
+	return &seconds
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type StockResponse struct {
+	Success bool      `json:"success"`
+	Data    StockData `json:"data,omitempty"`
+}
+
+type StockData struct {
+	Error   string `json:"error,omitempty"`
+	Deleted int64  `json:"deleted"`
+	// Confirm is the token a purge has to be sent again with before it deletes anything
+	Confirm string `json:"confirm,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+	Stock   int    `json:"stock,omitempty"`
+}
+
+// PurgeConfirmTimeout is how long a purge confirmation token can be used
+var PurgeConfirmTimeout = time.Minute
+
+/*
+purgeToken ~ A confirmation token handed out for a purge, it only works for the key it was given to
+*/
+type purgeToken struct {
+	key     string
+	expires time.Time
+}
+
+var (
+	purgeTokens     = map[string]purgeToken{}
+	purgeTokensLock sync.Mutex
+)
+
+var DeleteAltFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can delete stock
+	key := request.URL.Query().Get("key")
+	status, keyError := authorizeKey(key, true)
+	if keyError != "" {
+		writeJSON(writer, status, StockResponse{Success: false, Data: StockData{Error: keyError}}, "delete alt")
+		return
+	}
+
+	altId, err := strconv.Atoi(chi.URLParam(request, "id"))
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, StockResponse{Success: false, Data: StockData{Error: "invalid alt id"}}, "delete alt")
+		return
+	}
+
+	deleteAlt(writer, key, altId, "")
+}
+
+var DeleteStockFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can delete stock
+	key := request.URL.Query().Get("key")
+	status, keyError := authorizeKey(key, true)
+	if keyError != "" {
+		writeJSON(writer, status, StockResponse{Success: false, Data: StockData{Error: keyError}}, "delete stock")
+		return
+	}
+
+	// a single alt can be deleted by its email, otherwise everything in a pool or batch
+	query := request.URL.Query()
+	if email := query.Get("email"); email != "" {
+		deleteAlt(writer, key, 0, email)
+		return
+	}
+
+	pool := query.Get("pool")
+	if pool != "" && !database.IsValidPoolName(pool) {
+		writeJSON(writer, http.StatusBadRequest, StockResponse{Success: false, Data: StockData{Error: "invalid pool"}}, "delete stock")
+		return
+	}
+	var batch int64
+	if batchParam := query.Get("batch"); batchParam != "" {
+		var err error
+		batch, err = strconv.ParseInt(batchParam, 10, 64)
+		if err != nil || batch < 1 {
+			writeJSON(writer, http.StatusBadRequest, StockResponse{Success: false, Data: StockData{Error: "invalid batch"}}, "delete stock")
+			return
+		}
+	}
+	// deleting everything goes through the purge so it has to be confirmed
+	if pool == "" && batch == 0 {
+		writeJSON(writer, http.StatusBadRequest, StockResponse{Success: false, Data: StockData{Error: "email, pool or batch not set"}}, "delete stock")
+		return
+	}
+
+	deleted, err := database.Connection.DeleteAlts(key, pool, batch)
+	if err != nil {
+		log.Println("error deleting stock:", err)
+		writeJSON(writer, http.StatusInternalServerError, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "delete stock")
+		return
+	}
+	writeJSON(writer, http.StatusOK, StockResponse{Success: true, Data: StockData{Deleted: deleted}}, "delete stock")
+}
+
+/*
+deleteAlt ~ deletes a single alt by its id or email and writes the response
+*/
+func deleteAlt(writer http.ResponseWriter, key string, altId int, email string) {
+	err := database.Connection.DeleteAlt(key, altId, email)
+	switch {
+	case errors.Is(err, database.ErrAltNotFound):
+		writeJSON(writer, http.StatusNotFound, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "delete alt")
+		return
+	case errors.Is(err, database.ErrAltLeased):
+		writeJSON(writer, http.StatusConflict, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "delete alt")
+		return
+	case err != nil:
+		log.Println("error deleting alt:", err)
+		writeJSON(writer, http.StatusInternalServerError, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "delete alt")
+		return
+	}
+	writeJSON(writer, http.StatusOK, StockResponse{Success: true, Data: StockData{Deleted: 1}}, "delete alt")
+}
+
+var PurgeStockFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can purge stock
+	key := request.URL.Query().Get("key")
+	status, keyError := authorizeKey(key, true)
+	if keyError != "" {
+		writeJSON(writer, status, StockResponse{Success: false, Data: StockData{Error: keyError}}, "purge stock")
+		return
+	}
+
+	// without a confirmation token the purge only hands one out, along with how much stock it would delete
+	confirm := request.URL.Query().Get("confirm")
+	if confirm == "" {
+		stock, err := database.Connection.GetStockAmount()
+		if err != nil {
+			log.Println("error getting stock:", err)
+			writeJSON(writer, http.StatusInternalServerError, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "purge stock")
+			return
+		}
+		token, expires, err := newPurgeToken(key)
+		if err != nil {
+			log.Println("error creating purge token:", err)
+			writeJSON(writer, http.StatusInternalServerError, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "purge stock")
+			return
+		}
+		writeJSON(writer, http.StatusAccepted, StockResponse{Success: true, Data: StockData{Confirm: token, Expires: expires.Unix(), Stock: stock}}, "purge stock")
+		return
+	}
+
+	if !usePurgeToken(key, confirm) {
+		writeJSON(writer, http.StatusBadRequest, StockResponse{Success: false, Data: StockData{Error: "invalid or expired confirmation token"}}, "purge stock")
+		return
+	}
+
+	deleted, err := database.Connection.PurgeStock(key)
+	if err != nil {
+		log.Println("error purging stock:", err)
+		writeJSON(writer, http.StatusInternalServerError, StockResponse{Success: false, Data: StockData{Error: err.Error()}}, "purge stock")
+		return
+	}
+	writeJSON(writer, http.StatusOK, StockResponse{Success: true, Data: StockData{Deleted: deleted}}, "purge stock")
+}
+
+/*
+newPurgeToken ~ creates a random single use purge confirmation token for the key
+*/
+func newPurgeToken(key string) (string, time.Time, error) {
+	buffer := make([]byte, 16)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(buffer)
+	expires := time.Now().Add(PurgeConfirmTimeout)
+
+	purgeTokensLock.Lock()
+	defer purgeTokensLock.Unlock()
+	// forget tokens that were never used
+	for unused, purge := range purgeTokens {
+		if time.Now().After(purge.expires) {
+			delete(purgeTokens, unused)
+		}
+	}
+	purgeTokens[token] = purgeToken{key: key, expires: expires}
+	return token, expires, nil
+}
+
+/*
+usePurgeToken ~ checks the token was given to the key and hasn't expired, a token can only be used once
+*/
+func usePurgeToken(key string, token string) bool {
+	purgeTokensLock.Lock()
+	defer purgeTokensLock.Unlock()
+	purge, ok := purgeTokens[token]
+	if !ok {
+		return false
+	}
+	delete(purgeTokens, token)
+	return purge.key == key && time.Now().Before(purge.expires)
+}
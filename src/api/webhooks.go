@@ -0,0 +1,140 @@
+package api
+
+import (
+	"DortgenAPI/src/database"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type WebhooksResponse struct {
+	Success bool         `json:"success"`
+	Data    WebhooksData `json:"data,omitempty"`
+}
+
+type WebhooksData struct {
+	Error      string              `json:"error,omitempty"`
+	Webhook    *database.Webhook   `json:"webhook,omitempty"`
+	Webhooks   []database.Webhook  `json:"webhooks,omitempty"`
+	Deliveries []database.Delivery `json:"deliveries,omitempty"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+var WebhooksFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see webhooks
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, WebhooksResponse{Success: false, Data: WebhooksData{Error: keyError}}, "webhooks")
+		return
+	}
+
+	webhooks, err := database.Connection.GetWebhooks()
+	if err != nil {
+		log.Println("error getting webhooks:", err)
+		writeJSON(writer, http.StatusInternalServerError, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "webhooks")
+		return
+	}
+	writeJSON(writer, http.StatusOK, WebhooksResponse{Success: true, Data: WebhooksData{Webhooks: webhooks}}, "webhooks")
+}
+
+var CreateWebhookFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can add webhooks
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, WebhooksResponse{Success: false, Data: WebhooksData{Error: keyError}}, "create webhook")
+		return
+	}
+
+	var requestData CreateWebhookRequest
+	err := json.NewDecoder(request.Body).Decode(&requestData)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "create webhook")
+		return
+	}
+	err = database.ValidateWebhook(requestData.URL, requestData.Events)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "create webhook")
+		return
+	}
+
+	webhook, err := database.Connection.CreateWebhook(requestData.URL, requestData.Events)
+	if err != nil {
+		log.Println("error creating webhook:", err)
+		writeJSON(writer, http.StatusInternalServerError, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "create webhook")
+		return
+	}
+	log.Println(" [+] Added webhook", webhook.Id, "for", webhook.URL)
+	writeJSON(writer, http.StatusCreated, WebhooksResponse{Success: true, Data: WebhooksData{Webhook: webhook}}, "create webhook")
+}
+
+var DeleteWebhookFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can remove webhooks
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, WebhooksResponse{Success: false, Data: WebhooksData{Error: keyError}}, "delete webhook")
+		return
+	}
+
+	webhookId, err := strconv.ParseInt(chi.URLParam(request, "id"), 10, 64)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, WebhooksResponse{Success: false, Data: WebhooksData{Error: "invalid webhook id"}}, "delete webhook")
+		return
+	}
+
+	err = database.Connection.DeleteWebhook(webhookId)
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		writeJSON(writer, http.StatusNotFound, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "delete webhook")
+		return
+	}
+	if err != nil {
+		log.Println("error deleting webhook:", err)
+		writeJSON(writer, http.StatusInternalServerError, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "delete webhook")
+		return
+	}
+	log.Println(" [-] Removed webhook", webhookId)
+	writeJSON(writer, http.StatusOK, WebhooksResponse{Success: true}, "delete webhook")
+}
+
+var DeliveriesFunc = func(writer http.ResponseWriter, request *http.Request) {
+
+	// only admins can see the delivery log
+	status, keyError := authorizeKey(request.URL.Query().Get("key"), true)
+	if keyError != "" {
+		writeJSON(writer, status, WebhooksResponse{Success: false, Data: WebhooksData{Error: keyError}}, "deliveries")
+		return
+	}
+
+	webhookId, err := strconv.ParseInt(chi.URLParam(request, "id"), 10, 64)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, WebhooksResponse{Success: false, Data: WebhooksData{Error: "invalid webhook id"}}, "deliveries")
+		return
+	}
+	// an empty status lists every delivery
+	deliveryStatus := request.URL.Query().Get("status")
+	if deliveryStatus != "" && deliveryStatus != "pending" && deliveryStatus != "delivered" && deliveryStatus != "failed" {
+		writeJSON(writer, http.StatusBadRequest, WebhooksResponse{Success: false, Data: WebhooksData{Error: "invalid status (pending, delivered, failed)"}}, "deliveries")
+		return
+	}
+
+	deliveries, err := database.Connection.GetDeliveries(webhookId, deliveryStatus, 100)
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		writeJSON(writer, http.StatusNotFound, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "deliveries")
+		return
+	}
+	if err != nil {
+		log.Println("error getting deliveries:", err)
+		writeJSON(writer, http.StatusInternalServerError, WebhooksResponse{Success: false, Data: WebhooksData{Error: err.Error()}}, "deliveries")
+		return
+	}
+	writeJSON(writer, http.StatusOK, WebhooksResponse{Success: true, Data: WebhooksData{Deliveries: deliveries}}, "deliveries")
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AlertFormats are the payload formats low-stock webhooks can be sent in
+var AlertFormats = []string{"generic", "discord"}
+
+var (
+	// AlertDebounce is how long a pool has to stay below or above its threshold before an alert is sent,
+	// so stock going back and forth around the threshold doesn't flood the webhook
+	AlertDebounce = time.Minute
+	// AlertRetries is how many times a failed alert is sent again
+	AlertRetries = 5
+	// AlertBackoff is how long to wait before the first retry, it doubles with every retry
+	AlertBackoff = time.Second
+)
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+/*
+StockAlert ~ The generic payload sent when a pool runs low or is restored
+*/
+type StockAlert struct {
+	Event     string    `json:"event"`
+	Pool      string    `json:"pool"`
+	Stock     int       `json:"stock"`
+	Threshold int       `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+/*
+alertState ~ If the last alert of a pool said it was low, and since when it has been on the other side of the threshold
+*/
+type alertState struct {
+	low     bool
+	changed time.Time
+}
+
+/*
+validateAlert ~ Used to check the low-stock alert settings of a pool
+*/
+func validateAlert(pool Pool) error {
+	if pool.LowStock < 0 {
+		return errors.New("low_stock can't be negative")
+	}
+	validFormat := false
+	for _, format := range AlertFormats {
+		if pool.AlertFormat == format {
+			validFormat = true
+		}
+	}
+	if !validFormat {
+		return errors.New("invalid alert_format (generic, discord)")
+	}
+	if pool.AlertURL != "" {
+		parsed, err := url.Parse(pool.AlertURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("alert_url has to be a http or https url")
+		}
+	}
+	return nil
+}
+
+/*
+StartStockAlerts ~ Used to periodically check the stock of pools with a low-stock threshold and alert their webhook
+when stock drops below the threshold, and again once it is back at or above it
+*/
+func (database *DatabaseConnection) StartStockAlerts(interval time.Duration) {
+	go func() {
+		states := map[string]*alertState{}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			database.checkStockAlerts(states)
+		}
+	}()
+}
+
+/*
+checkStockAlerts ~ Used to compare the stock of every pool with its threshold and send the alerts that are due
+*/
+func (database *DatabaseConnection) checkStockAlerts(states map[string]*alertState) {
+	pools, err := database.GetPools()
+	if err != nil {
+		log.Println("error checking stock alerts:", err)
+		return
+	}
+	now := time.Now()
+	watched := map[string]struct{}{}
+	for _, pool := range pools {
+		if pool.LowStock == 0 || pool.AlertURL == "" {
+			continue
+		}
+		watched[pool.Name] = struct{}{}
+		state, ok := states[pool.Name]
+		if !ok {
+			// pools start out as restored, so a pool that is already low alerts once the debounce passed
+			state = &alertState{}
+			states[pool.Name] = state
+		}
+
+		low := pool.Stock < pool.LowStock
+		if low == state.low {
+			state.changed = time.Time{}
+			continue
+		}
+		if state.changed.IsZero() {
+			state.changed = now
+		}
+		if now.Sub(state.changed) < AlertDebounce {
+			continue
+		}
+		state.low = low
+		state.changed = time.Time{}
+
+		alert := StockAlert{Event: "stock_restored", Pool: pool.Name, Stock: pool.Stock, Threshold: pool.LowStock, Time: now.UTC()}
+		if low {
+			alert.Event = "stock_low"
+		}
+		go sendAlert(pool.AlertURL, pool.AlertFormat, alert)
+	}
+	// forget pools whose alerts were turned off so turning them back on starts over
+	for name := range states {
+		if _, ok := watched[name]; !ok {
+			delete(states, name)
+		}
+	}
+}
+
+/*
+alertPayload ~ Used to build the body of an alert in the format of the webhook
+*/
+func alertPayload(format string, alert StockAlert) ([]byte, error) {
+	if format != "discord" {
+		return json.Marshal(alert)
+	}
+	title := "Pool " + alert.Pool + " is running low"
+	color := 0xe74c3c
+	if alert.Event == "stock_restored" {
+		title = "Pool " + alert.Pool + " was restocked"
+		color = 0x2ecc71
+	}
+	return json.Marshal(map[string]any{
+		"embeds": []map[string]any{{
+			"title":       title,
+			"description": strconv.Itoa(alert.Stock) + " alts in stock, the threshold is " + strconv.Itoa(alert.Threshold),
+			"color":       color,
+			"timestamp":   alert.Time.Format(time.RFC3339),
+		}},
+	})
+}
+
+/*
+sendAlert ~ Used to post an alert to a webhook, failed posts are retried with exponential backoff
+*/
+func sendAlert(webhook string, format string, alert StockAlert) {
+	payload, err := alertPayload(format, alert)
+	if err != nil {
+		log.Println("error marshalling stock alert:", err)
+		return
+	}
+
+	backoff := AlertBackoff
+	for attempt := 0; ; attempt++ {
+		err = postAlert(webhook, payload)
+		if err == nil {
+			log.Println(" [!] Sent", alert.Event, "alert for pool", alert.Pool)
+			return
+		}
+		if attempt == AlertRetries {
+			log.Println("error sending", alert.Event, "alert for pool", alert.Pool, "after", attempt+1, "attempts:", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postAlert(webhook string, payload []byte) error {
+	response, err := alertClient.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New("webhook responded with " + response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type alertRequest struct {
+	path string
+	body []byte
+}
+
+/*
+alertServer ~ Used to stand in for the webhooks, failing the first failures requests with a 500
+*/
+func alertServer(t *testing.T, failures int32) (*httptest.Server, chan alertRequest, *atomic.Int32) {
+	received := make(chan alertRequest, 10)
+	attempts := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if attempts.Add(1) <= failures {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received <- alertRequest{path: request.URL.Path, body: body}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, received, attempts
+}
+
+func expectAlert(t *testing.T, received chan alertRequest) alertRequest {
+	t.Helper()
+	select {
+	case request := <-received:
+		return request
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alert was sent")
+	}
+	return alertRequest{}
+}
+
+func expectNoAlert(t *testing.T, received chan alertRequest) {
+	t.Helper()
+	select {
+	case request := <-received:
+		t.Fatalf("unexpected alert to %s: %s", request.path, request.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func setAlertTimings(t *testing.T) {
+	debounce, backoff := AlertDebounce, AlertBackoff
+	AlertDebounce = 200 * time.Millisecond
+	AlertBackoff = 10 * time.Millisecond
+	t.Cleanup(func() {
+		AlertDebounce, AlertBackoff = debounce, backoff
+	})
+}
+
+func TestStockAlertThreshold(t *testing.T) {
+	setAlertTimings(t)
+	database := newTestDatabase(t)
+	testKey(t, database, "test", 0)
+	server, received, _ := alertServer(t, 0)
+
+	pool := defaultPool("alerts")
+	pool.LowStock = 3
+	pool.AlertURL = server.URL + "/generic"
+	err := database.SavePool(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restockTest(t, database, "alerts", "first", 5)
+	states := map[string]*alertState{}
+	database.checkStockAlerts(states)
+	expectNoAlert(t, received)
+
+	// dropping below the threshold and going back up within the debounce doesn't alert
+	_, err = database.DispenseAlts("test", "alerts", 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.checkStockAlerts(states)
+	restockTest(t, database, "alerts", "second", 3)
+	database.checkStockAlerts(states)
+	time.Sleep(AlertDebounce)
+	database.checkStockAlerts(states)
+	expectNoAlert(t, received)
+
+	// staying below the threshold for the debounce alerts once
+	_, err = database.DispenseAlts("test", "alerts", 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.checkStockAlerts(states)
+	expectNoAlert(t, received)
+	time.Sleep(AlertDebounce)
+	database.checkStockAlerts(states)
+	request := expectAlert(t, received)
+	var alert StockAlert
+	err = json.Unmarshal(request.body, &alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.path != "/generic" || alert.Event != "stock_low" || alert.Pool != "alerts" || alert.Stock != 1 || alert.Threshold != 3 {
+		t.Fatalf("got alert %+v to %s", alert, request.path)
+	}
+	time.Sleep(AlertDebounce)
+	database.checkStockAlerts(states)
+	expectNoAlert(t, received)
+
+	// going back up to the threshold alerts that stock was restored
+	restockTest(t, database, "alerts", "third", 2)
+	database.checkStockAlerts(states)
+	time.Sleep(AlertDebounce)
+	database.checkStockAlerts(states)
+	request = expectAlert(t, received)
+	err = json.Unmarshal(request.body, &alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Event != "stock_restored" || alert.Stock != 3 {
+		t.Fatalf("got alert %+v, want stock_restored with 3 in stock", alert)
+	}
+}
+
+func TestStockAlertRetry(t *testing.T) {
+	setAlertTimings(t)
+	server, received, attempts := alertServer(t, 2)
+
+	go sendAlert(server.URL+"/retry", "generic", StockAlert{Event: "stock_low", Pool: "retry", Stock: 1, Threshold: 2})
+	request := expectAlert(t, received)
+	if request.path != "/retry" || attempts.Load() != 3 {
+		t.Fatalf("alert arrived at %s after %d attempts, want /retry after 3", request.path, attempts.Load())
+	}
+}
+
+func TestAlertPayloads(t *testing.T) {
+	alert := StockAlert{Event: "stock_low", Pool: "vip", Stock: 1, Threshold: 5, Time: time.Unix(1700000000, 0).UTC()}
+
+	payload, err := alertPayload("generic", alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generic map[string]any
+	err = json.Unmarshal(payload, &generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"event", "pool", "stock", "threshold", "time"} {
+		if _, ok := generic[field]; !ok {
+			t.Fatalf("generic payload %s has no %s", payload, field)
+		}
+	}
+
+	payload, err = alertPayload("discord", alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var discord struct {
+		Content string `json:"content"`
+		Embeds  []struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			Color       int    `json:"color"`
+			Timestamp   string `json:"timestamp"`
+		} `json:"embeds"`
+	}
+	err = json.Unmarshal(payload, &discord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discord.Embeds) != 1 || !strings.Contains(discord.Embeds[0].Title, "vip") || discord.Embeds[0].Timestamp != "2023-11-14T22:13:20Z" {
+		t.Fatalf("discord payload %s isn't a single embed about the pool", payload)
+	}
+	if _, ok := generic["embeds"]; ok {
+		t.Fatal("generic payload has discord embeds")
+	}
+
+	alert.Event = "stock_restored"
+	restored, err := alertPayload("discord", alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) == string(payload) {
+		t.Fatal("low and restored discord alerts are the same")
+	}
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrBatchNotFound   = errors.New("batch not found")
+	ErrBatchRolledBack = errors.New("batch already rolled back")
+	ErrBatchImporting  = errors.New("batch is still importing")
+)
+
+/*
+createBatch ~ Used to record an import as a batch before its alts are added
+*/
+func (database *DatabaseConnection) createBatch(options ImportOptions) (int64, error) {
+	format := options.Format
+	if format == "" {
+		format = "colon"
+	}
+	var batchId int64
+	err := database.Database.QueryRow("INSERT INTO batches (apikey, source, format, pool) VALUES (?, ?, ?, ?) RETURNING id",
+		options.Key, options.Source, format, options.Pool).Scan(&batchId)
+	return batchId, err
+}
+
+/*
+finishBatch ~ Used to record the outcome of an import on its batch
+*/
+func (database *DatabaseConnection) finishBatch(batchId int64, report *RestockReport, importError error) {
+	var err error
+	if importError != nil {
+		// imports that weren't atomic may have committed some alts before failing
+		_, err = database.Database.Exec(`UPDATE batches SET status = 'failed', error = ?,
+											added = (SELECT COUNT(*) FROM altlist WHERE batch = batches.id) WHERE id = ?`,
+			importError.Error(), batchId)
+	} else {
+		rejected := report.Duplicate + report.Malformed + report.Failed
+		for _, invalid := range report.Invalid {
+			rejected += invalid
+		}
+		_, err = database.Database.Exec("UPDATE batches SET status = 'done', total = ?, added = ?, rejected = ? WHERE id = ?",
+			report.Total, report.Added, rejected, batchId)
+	}
+	if err != nil {
+		log.Println("error finishing import batch:", err)
+	}
+}
+
+/*
+FailInterruptedBatches ~ Used on startup to fail batches that were still importing when the server stopped
+*/
+func (database *DatabaseConnection) FailInterruptedBatches() error {
+	_, err := database.Database.Exec(`UPDATE batches SET status = 'failed', error = 'interrupted by restart',
+										added = (SELECT COUNT(*) FROM altlist WHERE batch = batches.id) WHERE status = 'importing'`)
+	return err
+}
+
+// batchColumns are the columns read by scanBatch, along with who restocked the batch and how many of its alts are still in stock and were dispensed.
+// The owner is shown instead of the key so listing batches doesn't give keys away, batches from the inbox have no key to look up
+const batchColumns = `id, COALESCE((SELECT owner FROM apikeys WHERE apikey = batches.apikey), batches.apikey), source, format, pool, status, total, added, rejected, error, created, rolledback, removed,
+						(SELECT COUNT(*) FROM altlist WHERE batch = batches.id), (SELECT COUNT(*) FROM dispenses WHERE batch = batches.id)`
+
+func scanBatch(row interface{ Scan(...any) error }) (*Batch, error) {
+	var batch Batch
+	err := row.Scan(&batch.Id, &batch.Owner, &batch.Source, &batch.Format, &batch.Pool, &batch.Status, &batch.Total, &batch.Added,
+		&batch.Rejected, &batch.Error, &batch.Created, &batch.RolledBack, &batch.Removed, &batch.InStock, &batch.Dispensed)
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+/*
+GetBatch ~ Used to get an import batch by its id
+*/
+func (database *DatabaseConnection) GetBatch(batchId int64) (*Batch, error) {
+	batch, err := scanBatch(database.Database.QueryRow("SELECT "+batchColumns+" FROM batches WHERE id = ?", batchId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBatchNotFound
+	}
+	return batch, err
+}
+
+/*
+GetBatches ~ Used to get the most recent import batches, optionally only those of one pool
+*/
+func (database *DatabaseConnection) GetBatches(pool string, limit int) ([]Batch, error) {
+	var result *sql.Rows
+	var err error
+	if pool == "" {
+		result, err = database.Database.Query("SELECT "+batchColumns+" FROM batches ORDER BY id DESC LIMIT ?", limit)
+	} else {
+		result, err = database.Database.Query("SELECT "+batchColumns+" FROM batches WHERE pool = ? ORDER BY id DESC LIMIT ?", pool, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	batches := []Batch{}
+	for result.Next() {
+		batch, err := scanBatch(result)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, *batch)
+	}
+	return batches, result.Err()
+}
+
+/*
+RollbackBatch ~ Used to remove the alts of a batch that are still in stock, dispensed alts are left alone.
+Their fingerprints are forgotten so they can be imported again, unless they were imported before the batch.
+Leased alts of the batch are removed once their lease expires instead of returning to stock. Returns the amount removed
+*/
+func (database *DatabaseConnection) RollbackBatch(batchId int64) (int, error) {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// marking the batch first takes the write lock straight away, so a concurrent rollback waits instead of deadlocking
+	var created int64
+	err = tx.QueryRow("UPDATE batches SET status = 'rolledback', rolledback = ? WHERE id = ? AND status NOT IN ('rolledback', 'importing') RETURNING created",
+		time.Now().Unix(), batchId).Scan(&created)
+	if errors.Is(err, sql.ErrNoRows) {
+		batch, err := database.GetBatch(batchId)
+		if err != nil {
+			return 0, err
+		}
+		if batch.Status == "importing" {
+			return 0, ErrBatchImporting
+		}
+		return 0, ErrBatchRolledBack
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Query("DELETE FROM altlist WHERE batch = ? AND leaseid = '' RETURNING email", batchId)
+	if err != nil {
+		return 0, err
+	}
+	var emails []string
+	for result.Next() {
+		var email string
+		err = result.Scan(&email)
+		if err != nil {
+			_ = result.Close()
+			return 0, err
+		}
+		emails = append(emails, email)
+	}
+	_ = result.Close()
+	if err = result.Err(); err != nil {
+		return 0, err
+	}
+
+	forget, err := tx.Prepare("DELETE FROM fingerprints WHERE fingerprint = ? AND created >= ?")
+	if err != nil {
+		return 0, err
+	}
+	defer func(forget *sql.Stmt) {
+		_ = forget.Close()
+	}(forget)
+	for _, email := range emails {
+		_, err = forget.Exec(Fingerprint(email), created)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE batches SET removed = ? WHERE id = ?", len(emails), batchId)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	markStockChanged()
+	log.Println(" [-] Rolled back batch", batchId, "removing", len(emails), "alts from stock")
+	return len(emails), nil
+}
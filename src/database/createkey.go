@@ -4,9 +4,19 @@ import (
 	"database/sql"
 	"errors"
 	"math/rand"
+	"strings"
 )
 
-func (database *DatabaseConnection) CreateApiKey(user string, keyLength int) error {
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrAdminKey    = errors.New("the admin key can't be disabled")
+)
+
+/*
+CreateApiKey ~ Used to create a new api key for a user, maxBatch, quota and replaceLimit of 0 use the server defaults
+and an empty pools list allows every pool
+*/
+func (database *DatabaseConnection) CreateApiKey(user string, keyLength int, maxBatch int, quota int, replaceLimit int, pools []string) error {
 	keyCreator := KeyCreator{
 		keyLength: keyLength,
 	}
@@ -16,8 +26,45 @@ func (database *DatabaseConnection) CreateApiKey(user string, keyLength int) err
 	}
 
 	// insert the key into the database
-	_, err = database.Database.Exec("INSERT INTO apikeys (apikey, owner) VALUES (?, ?)", key, user)
-	return err
+	_, err = database.Database.Exec("INSERT INTO apikeys (apikey, owner, maxbatch, quota, replacelimit, pools) VALUES (?, ?, ?, ?, ?, ?)",
+		key, user, maxBatch, quota, replaceLimit, strings.Join(pools, ","))
+	if err != nil {
+		return err
+	}
+	database.publishEvent(EventKeyCreated, KeyEvent{Owner: user, MaxBatch: maxBatch, Quota: quota, ReplaceLimit: replaceLimit, Pools: pools})
+	return nil
+}
+
+/*
+SetKeyDisabled ~ Used to disable or enable the key of an owner, the admin key can't be disabled
+*/
+func (database *DatabaseConnection) SetKeyDisabled(owner string, disabled bool) error {
+	if owner == "admin" {
+		return ErrAdminKey
+	}
+	updated, err := database.Database.Exec("UPDATE apikeys SET disabled = ? WHERE owner = ? AND disabled != ?", disabled, owner, disabled)
+	if err != nil {
+		return err
+	}
+	affected, err := updated.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		ownerExists, err := database.DoesOwnerExist(owner)
+		if err != nil {
+			return err
+		}
+		if !ownerExists {
+			return ErrKeyNotFound
+		}
+		// the key already was disabled or enabled
+		return nil
+	}
+	if disabled {
+		database.publishEvent(EventKeyDisabled, KeyEvent{Owner: owner})
+	}
+	return nil
 }
 
 /*
@@ -100,3 +147,35 @@ func (databaseConnection *DatabaseConnection) IsKeyDisabled(key string) (bool, e
 	}
 	return true, errors.New("key not found")
 }
+
+/*
+GetKeyLimits ~ Used to get the max batch size, quota and current uses of a key
+*/
+func (databaseConnection *DatabaseConnection) GetKeyLimits(key string) (maxBatch int, quota int, uses int, err error) {
+	err = databaseConnection.Database.QueryRow("SELECT maxbatch, quota, uses FROM apikeys WHERE apikey = ?", key).Scan(&maxBatch, &quota, &uses)
+	return maxBatch, quota, uses, err
+}
+
+/*
+CanUsePool ~ Used to check if a key is allowed to generate from a pool, the admin can use every pool
+*/
+func (databaseConnection *DatabaseConnection) CanUsePool(key string, pool string) (bool, error) {
+	return canUsePool(databaseConnection.Database, key, pool)
+}
+
+func canUsePool(database queryRower, key string, pool string) (bool, error) {
+	var owner, pools string
+	err := database.QueryRow("SELECT owner, pools FROM apikeys WHERE apikey = ?", key).Scan(&owner, &pools)
+	if err != nil {
+		return false, err
+	}
+	if owner == "admin" || pools == "" {
+		return true, nil
+	}
+	for _, allowed := range strings.Split(pools, ",") {
+		if allowed == pool {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrAltNotFound = errors.New("alt not found")
+	ErrAltLeased   = errors.New("alt is leased")
+)
+
+/*
+recordAudit ~ Used to record a change to stock in the audit log, in the same transaction as the change
+*/
+func recordAudit(tx *sql.Tx, key string, action string, target string, count int64) error {
+	_, err := tx.Exec("INSERT INTO audit (apikey, action, target, count) VALUES (?, ?, ?, ?)", key, action, target, count)
+	return err
+}
+
+/*
+deleteStock ~ Used to delete the alts in stock matching the condition and record it in the audit log.
+Leased alts are never deleted since their client may still confirm them. Returns the amount deleted
+*/
+func (database *DatabaseConnection) deleteStock(key string, action string, target string, condition string, args ...any) (int64, error) {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	result, err := tx.Exec("DELETE FROM altlist WHERE leaseid = '' AND "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	err = recordAudit(tx, key, action, target, deleted)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	markStockChanged()
+	log.Println(" [-] Deleted", deleted, "alts from stock ("+action, target+")")
+	return deleted, nil
+}
+
+/*
+DeleteAlt ~ Used to delete a single alt from stock by its id or email, deleting nothing is recorded too
+*/
+func (database *DatabaseConnection) DeleteAlt(key string, id int, email string) error {
+	condition, target, arg := "id = ?", "id "+strconv.Itoa(id), any(id)
+	if email != "" {
+		condition, target, arg = "email = ?", "email "+email, any(email)
+	}
+	deleted, err := database.deleteStock(key, "delete", target, condition, arg)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		leased, err := exists(database.Database, "SELECT 1 FROM altlist WHERE "+condition, arg)
+		if err != nil {
+			return err
+		}
+		if leased {
+			return ErrAltLeased
+		}
+		return ErrAltNotFound
+	}
+	return nil
+}
+
+/*
+DeleteAlts ~ Used to delete the alts in stock of a pool, a batch or both. Returns the amount deleted
+*/
+func (database *DatabaseConnection) DeleteAlts(key string, pool string, batch int64) (int64, error) {
+	var conditions, targets []string
+	var args []any
+	if pool != "" {
+		conditions = append(conditions, "pool = ?")
+		targets = append(targets, "pool "+pool)
+		args = append(args, pool)
+	}
+	if batch != 0 {
+		conditions = append(conditions, "batch = ?")
+		targets = append(targets, "batch "+strconv.FormatInt(batch, 10))
+		args = append(args, batch)
+	}
+	if len(conditions) == 0 {
+		return 0, errors.New("no pool or batch to delete")
+	}
+	return database.deleteStock(key, "delete", strings.Join(targets, ", "), strings.Join(conditions, " AND "), args...)
+}
+
+/*
+PurgeStock ~ Used to delete every alt in stock. Returns the amount deleted
+*/
+func (database *DatabaseConnection) PurgeStock(key string) (int64, error) {
+	return database.deleteStock(key, "purge", "", "TRUE")
+}
+
+const auditColumns = "id, COALESCE((SELECT owner FROM apikeys WHERE apikey = audit.apikey), audit.apikey), action, target, count, created"
+
+/*
+GetAudit ~ Used to get the most recent audit entries
+*/
+func (database *DatabaseConnection) GetAudit(limit int) ([]AuditEntry, error) {
+	result, err := database.Database.Query("SELECT "+auditColumns+" FROM audit ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	entries := []AuditEntry{}
+	for result.Next() {
+		var entry AuditEntry
+		err = result.Scan(&entry.Id, &entry.Owner, &entry.Action, &entry.Target, &entry.Count, &entry.Created)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, result.Err()
+}
@@ -0,0 +1,447 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EncryptionKeyEnv is the environment variable the master key is read from when no key file is set
+const EncryptionKeyEnv = "DORTGEN_KEY"
+
+// encryptedPrefix marks an encrypted password, it is followed by the id of the data key and the base64 nonce and ciphertext
+const encryptedPrefix = "enc:v1:"
+
+var (
+	ErrNoEncryptionKey    = errors.New("database has encrypted passwords but no encryption key is set (-keyfile or " + EncryptionKeyEnv + ")")
+	ErrWrongEncryptionKey = errors.New("encryption key can't unlock the data keys of the database")
+)
+
+/*
+keyring ~ The data keys passwords are encrypted with, unwrapped with the master key.
+New passwords are encrypted with the newest data key, older ones are kept until everything is re-encrypted
+*/
+type keyring struct {
+	master cipher.AEAD
+	raw    map[int64][]byte
+	keys   map[int64]cipher.AEAD
+	active int64
+}
+
+/*
+add ~ Used to put an unwrapped data key in the keyring
+*/
+func (keys *keyring) add(id int64, dataKey []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	keys.raw[id] = dataKey
+	keys.keys[id] = aead
+	if id > keys.active {
+		keys.active = id
+	}
+	return nil
+}
+
+// passwordKeys is nil when encryption isn't set up, passwords are then stored as they are
+var passwordKeys *keyring
+
+// EncryptionKey is the master key data keys are wrapped with, set before Startup to enable encryption
+var EncryptionKey []byte
+
+/*
+LoadEncryptionKey ~ Used to read the master key from the key file, or the environment when no file is set.
+The key is 32 bytes encoded as base64, no key returns nil
+*/
+func LoadEncryptionKey(keyFile string) ([]byte, error) {
+	encoded := os.Getenv(EncryptionKeyEnv)
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(content)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("encryption key is not base64: " + err.Error())
+	}
+	if len(key) != 32 {
+		return nil, errors.New("encryption key has to be 32 bytes, got " + strconv.Itoa(len(key)))
+	}
+	return key, nil
+}
+
+/*
+GenerateEncryptionKey ~ Used to create a new random master key, encoded as base64 the way LoadEncryptionKey reads it
+*/
+func GenerateEncryptionKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func open(aead cipher.AEAD, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+/*
+SetupEncryption ~ Used on startup to unlock the data keys with EncryptionKey, creating the first data key if there is none.
+Passwords still stored in plaintext are encrypted in the same transaction, so nothing stays readable once a key is set.
+Refuses to go on when the database has encrypted data but no key is set, or the key is wrong
+*/
+func (database *DatabaseConnection) SetupEncryption() error {
+	passwordKeys = nil
+	if EncryptionKey == nil {
+		encrypted, err := exists(database.Database, "SELECT 1 FROM datakeys LIMIT 1")
+		if err != nil {
+			return err
+		}
+		if encrypted {
+			return ErrNoEncryptionKey
+		}
+		return nil
+	}
+
+	keys, err := database.loadKeyring(EncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	created := len(keys.keys) == 0
+	if created {
+		_, err = addDataKey(tx, keys)
+		if err != nil {
+			return err
+		}
+	}
+	encrypted := 0
+	for _, table := range []string{"altlist", "dispenses"} {
+		count, err := reencryptTable(tx, table, " AND password NOT LIKE '"+encryptedPrefix+"%'", nil, keys)
+		encrypted += count
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if created {
+		log.Println("Created a new data key for password encryption")
+	}
+	if encrypted > 0 {
+		log.Println(" [+] Encrypted", encrypted, "passwords that were stored in plaintext")
+	}
+	passwordKeys = keys
+	return nil
+}
+
+/*
+loadKeyring ~ Used to unwrap every data key with the master key
+*/
+func (database *DatabaseConnection) loadKeyring(masterKey []byte) (*keyring, error) {
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	keys := &keyring{master: master, raw: map[int64][]byte{}, keys: map[int64]cipher.AEAD{}}
+
+	result, err := database.Database.Query("SELECT id, wrapped FROM datakeys")
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+	for result.Next() {
+		var id int64
+		var wrapped string
+		err = result.Scan(&id, &wrapped)
+		if err != nil {
+			return nil, err
+		}
+		dataKey, err := open(master, wrapped)
+		if err != nil {
+			return nil, ErrWrongEncryptionKey
+		}
+		err = keys.add(id, dataKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, result.Err()
+}
+
+/*
+addDataKey ~ Used to create a random data key, store it wrapped with the master key and make it the active key
+*/
+func addDataKey(database queryRower, keys *keyring) (int64, error) {
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return 0, err
+	}
+	wrapped, err := seal(keys.master, dataKey)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = database.QueryRow("INSERT INTO datakeys (wrapped) VALUES (?) RETURNING id", wrapped).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, keys.add(id, dataKey)
+}
+
+/*
+encryptPassword ~ Used to encrypt a password before it is stored, passwords are stored as they are without encryption set up
+*/
+func encryptPassword(password string) (string, error) {
+	if passwordKeys == nil {
+		return password, nil
+	}
+	return passwordKeys.encrypt(password)
+}
+
+func (keys *keyring) encrypt(password string) (string, error) {
+	sealed, err := seal(keys.keys[keys.active], []byte(password))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + strconv.FormatInt(keys.active, 10) + ":" + sealed, nil
+}
+
+/*
+decryptPassword ~ Used to decrypt a stored password, passwords stored before encryption was set up are returned as they are.
+Imports reject passwords starting with encryptedPrefix so a plaintext password is never taken for an encrypted one
+*/
+func decryptPassword(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	if passwordKeys == nil {
+		return "", ErrNoEncryptionKey
+	}
+	return passwordKeys.decrypt(stored)
+}
+
+func (keys *keyring) decrypt(stored string) (string, error) {
+	keyId, sealed, found := strings.Cut(strings.TrimPrefix(stored, encryptedPrefix), ":")
+	if !found {
+		return "", errors.New("malformed encrypted password")
+	}
+	id, err := strconv.ParseInt(keyId, 10, 64)
+	if err != nil {
+		return "", errors.New("malformed encrypted password")
+	}
+	aead, ok := keys.keys[id]
+	if !ok {
+		return "", fmt.Errorf("data key %d of encrypted password not found", id)
+	}
+	password, err := open(aead, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+/*
+RotateEncryptionKey ~ Used to wrap the data keys with a new master key, and if asked to re-encrypt every password with a new data key.
+Plaintext passwords are encrypted by the re-encryption too. Everything happens in one transaction so an interrupted rotation changes nothing.
+Returns the amount of passwords that were re-encrypted
+*/
+func (database *DatabaseConnection) RotateEncryptionKey(newMasterKey []byte, reencrypt bool) (int, error) {
+	if EncryptionKey == nil {
+		return 0, errors.New("no current encryption key set, set it with -keyfile or " + EncryptionKeyEnv)
+	}
+	if newMasterKey == nil {
+		newMasterKey = EncryptionKey
+	}
+	keys, err := database.loadKeyring(EncryptionKey)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// the data keys stay the same, only the master key they are wrapped with changes
+	master, err := newAEAD(newMasterKey)
+	if err != nil {
+		return 0, err
+	}
+	rotated := &keyring{master: master, raw: map[int64][]byte{}, keys: map[int64]cipher.AEAD{}}
+	for id, dataKey := range keys.raw {
+		wrapped, err := seal(master, dataKey)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec("UPDATE datakeys SET wrapped = ? WHERE id = ?", wrapped, id)
+		if err != nil {
+			return 0, err
+		}
+		err = rotated.add(id, dataKey)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	reencrypted := 0
+	if reencrypt {
+		_, err = addDataKey(tx, rotated)
+		if err != nil {
+			return 0, err
+		}
+		for _, table := range []string{"altlist", "dispenses"} {
+			count, err := reencryptTable(tx, table, "", keys, rotated)
+			reencrypted += count
+			if err != nil {
+				return reencrypted, err
+			}
+		}
+		// nothing is encrypted with the old data keys anymore
+		_, err = tx.Exec("DELETE FROM datakeys WHERE id != ?", rotated.active)
+		if err != nil {
+			return reencrypted, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	EncryptionKey = newMasterKey
+	passwordKeys = rotated
+	return reencrypted, nil
+}
+
+// reencryptBatch is how many passwords are read into memory at a time while encrypting a table
+const reencryptBatch = 1000
+
+/*
+reencryptTable ~ Used to encrypt the passwords of a table the condition selects with the active data key of the rotated keyring,
+current decrypts the ones that are encrypted already and can be nil when the condition only selects plaintext.
+Rows are read in batches ordered by id so a large table isn't held in memory at once
+*/
+func reencryptTable(tx *sql.Tx, table string, condition string, current *keyring, rotated *keyring) (int, error) {
+	update, err := tx.Prepare("UPDATE " + table + " SET password = ? WHERE id = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer func(update *sql.Stmt) {
+		_ = update.Close()
+	}(update)
+
+	reencrypted := 0
+	var lastId int64
+	for {
+		ids, passwords, err := passwordBatch(tx, table, condition, lastId)
+		if err != nil {
+			return reencrypted, err
+		}
+		if len(ids) == 0 {
+			return reencrypted, nil
+		}
+		for index, id := range ids {
+			password := passwords[index]
+			if strings.HasPrefix(password, encryptedPrefix) {
+				password, err = current.decrypt(password)
+				if err != nil {
+					return reencrypted, fmt.Errorf("decrypting %s %d: %w", table, id, err)
+				}
+			}
+			encrypted, err := rotated.encrypt(password)
+			if err != nil {
+				return reencrypted, err
+			}
+			_, err = update.Exec(encrypted, id)
+			if err != nil {
+				return reencrypted, err
+			}
+			reencrypted++
+		}
+		lastId = ids[len(ids)-1]
+	}
+}
+
+/*
+passwordBatch ~ Used to read the next batch of ids and passwords the condition selects after the given id
+*/
+func passwordBatch(tx *sql.Tx, table string, condition string, afterId int64) ([]int64, []string, error) {
+	result, err := tx.Query("SELECT id, password FROM "+table+" WHERE id > ?"+condition+" ORDER BY id LIMIT ?", afterId, reencryptBatch)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	var ids []int64
+	var passwords []string
+	for result.Next() {
+		var id int64
+		var stored string
+		err = result.Scan(&id, &stored)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		passwords = append(passwords, stored)
+	}
+	return ids, passwords, result.Err()
+}
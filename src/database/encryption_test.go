@@ -0,0 +1,92 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStartupEncryptsPlaintext(t *testing.T) {
+	folder := t.TempDir()
+	EncryptionKey = nil
+	t.Cleanup(func() {
+		EncryptionKey = nil
+		passwordKeys = nil
+	})
+	err := Startup(folder, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKey(t, Connection, "encryption", 0)
+	// more than a batch so the re-encryption has to go past the first one
+	restockTest(t, Connection, "default", "plain", reencryptBatch+2)
+	_, err = Connection.DispenseAlts("encryption", "default", 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = Connection.Database.Close()
+
+	// starting with a key encrypts what was stored before it was set
+	key, err := GenerateEncryptionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	EncryptionKey, err = base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database := newTestDatabaseIn(t, folder)
+	plaintext, err := exists(database.Database, "SELECT 1 FROM altlist WHERE password NOT LIKE '"+encryptedPrefix+"%' UNION ALL SELECT 1 FROM dispenses WHERE password NOT LIKE '"+encryptedPrefix+"%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext {
+		t.Fatal("passwords are still stored in plaintext after starting with a key")
+	}
+	alts, err := database.DispenseAlts("encryption", "default", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alt := range alts {
+		if alt.Password != "p" {
+			t.Fatalf("dispensed password %q, want p", alt.Password)
+		}
+	}
+}
+
+func TestImportRejectsEncryptedPrefix(t *testing.T) {
+	database := newTestDatabase(t)
+	report, err := database.AddAccountsFromFile(strings.NewReader("a@example.com:"+encryptedPrefix+"1:abc\nb@example.com:fine"), ImportOptions{Pool: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Invalid["reserved_prefix"] != 1 {
+		t.Fatalf("added %d and rejected %v, want 1 added and 1 reserved_prefix", report.Added, report.Invalid)
+	}
+}
+
+func TestSpoolFile(t *testing.T) {
+	upload := strings.Repeat("spooled@example.com:secretpassword\n", spoolChunk/10)
+	var spooled bytes.Buffer
+	key, err := spoolFile(&spooled, strings.NewReader(upload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(spooled.Bytes(), []byte("secretpassword")) {
+		t.Fatal("spooled upload contains the password in plaintext")
+	}
+
+	reader, err := newSpoolReader(&spooled, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != upload {
+		t.Fatalf("read back %d bytes, want the %d bytes that were spooled", len(read), len(upload))
+	}
+}
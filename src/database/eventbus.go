@@ -0,0 +1,195 @@
+package database
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventStockChanged is sent on the event bus when the stock of a pool changed, it isn't sent to webhooks
+const EventStockChanged = "stock.changed"
+
+var (
+	// EventHistory is how many events the bus keeps so subscribers can resume after reconnecting
+	EventHistory = 1000
+	// SubscriberBuffer is how many events can wait for a subscriber before it is dropped for being too slow
+	SubscriberBuffer = 64
+)
+
+/*
+BusEvent ~ An event on the event bus, ids are only meaningful to the server run that published them
+*/
+type BusEvent struct {
+	Id       string
+	Type     string
+	Data     any
+	sequence int64
+}
+
+type StockEvent struct {
+	Pool  string `json:"pool"`
+	Stock int    `json:"stock"`
+}
+
+/*
+Subscription ~ The events published on the bus since subscribing, the channel is closed if the subscriber fell too far behind
+*/
+type Subscription struct {
+	Events <-chan BusEvent
+	events chan BusEvent
+}
+
+/*
+eventBus ~ Passes events to everyone subscribed in this process and keeps the most recent ones to resume from
+*/
+type eventBus struct {
+	lock        sync.Mutex
+	boot        string
+	sequence    int64
+	history     []BusEvent
+	subscribers map[*Subscription]struct{}
+}
+
+// the run is part of every id, so an id from before a restart is never mistaken for one of this run
+var bus = &eventBus{boot: strconv.FormatInt(time.Now().UnixNano(), 36), subscribers: map[*Subscription]struct{}{}}
+
+/*
+publish ~ Used to give an event an id, keep it in the history and pass it to every subscriber.
+Subscribers whose buffer is full are dropped instead of holding up the publisher, they can resume from their last event
+*/
+func (bus *eventBus) publish(eventType string, data any) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	bus.sequence++
+	event := BusEvent{Id: bus.boot + "-" + strconv.FormatInt(bus.sequence, 10), Type: eventType, Data: data, sequence: bus.sequence}
+	bus.history = append(bus.history, event)
+	if len(bus.history) > EventHistory {
+		bus.history = bus.history[len(bus.history)-EventHistory:]
+	}
+	for subscription := range bus.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			delete(bus.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+/*
+missedSince ~ Used to get the events after the given id, false if the id isn't from this run or is older than the history
+*/
+func (bus *eventBus) missedSince(lastEventId string) ([]BusEvent, bool) {
+	boot, sequenceId, found := strings.Cut(lastEventId, "-")
+	if !found || boot != bus.boot {
+		return nil, false
+	}
+	sequence, err := strconv.ParseInt(sequenceId, 10, 64)
+	if err != nil || sequence > bus.sequence {
+		return nil, false
+	}
+	oldest := bus.sequence + 1
+	if len(bus.history) > 0 {
+		oldest = bus.history[0].sequence
+	}
+	if sequence < oldest-1 {
+		return nil, false
+	}
+
+	var missed []BusEvent
+	for _, event := range bus.history {
+		if event.sequence > sequence {
+			missed = append(missed, event)
+		}
+	}
+	return missed, true
+}
+
+/*
+SubscribeEvents ~ Used to receive the events published from now on, along with the ones missed since lastEventId.
+Returns false if the missed events couldn't be found, the subscriber then has to catch up on the current state itself
+*/
+func SubscribeEvents(lastEventId string) (*Subscription, []BusEvent, bool) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	events := make(chan BusEvent, SubscriberBuffer)
+	subscription := &Subscription{Events: events, events: events}
+	bus.subscribers[subscription] = struct{}{}
+	if lastEventId == "" {
+		return subscription, nil, false
+	}
+	missed, resumed := bus.missedSince(lastEventId)
+	return subscription, missed, resumed
+}
+
+/*
+UnsubscribeEvents ~ Used to stop receiving events
+*/
+func UnsubscribeEvents(subscription *Subscription) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	if _, ok := bus.subscribers[subscription]; ok {
+		delete(bus.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+func (bus *eventBus) hasSubscribers() bool {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	return len(bus.subscribers) > 0
+}
+
+// stockChanged is signalled whenever stock may have changed, it holds at most one signal so changes in a burst are counted once
+var stockChanged = make(chan struct{}, 1)
+
+/*
+markStockChanged ~ Used to let the stock watcher know stock changed, never blocks
+*/
+func markStockChanged() {
+	select {
+	case stockChanged <- struct{}{}:
+	default:
+	}
+}
+
+/*
+StartStockEvents ~ Used to publish the stock of every pool that changed, counting stock at most once per interval
+however often it changes. Stock is only counted while someone is subscribed
+*/
+func (database *DatabaseConnection) StartStockEvents(interval time.Duration) {
+	go func() {
+		last, err := database.GetStockPerPool()
+		if err != nil {
+			log.Println("error getting stock for stock events:", err)
+			last = map[string]int{}
+		}
+		for range stockChanged {
+			time.Sleep(interval)
+			if !bus.hasSubscribers() {
+				continue
+			}
+			current, err := database.GetStockPerPool()
+			if err != nil {
+				log.Println("error getting stock for stock events:", err)
+				continue
+			}
+			for pool, stock := range current {
+				if last[pool] != stock {
+					bus.publish(EventStockChanged, StockEvent{Pool: pool, Stock: stock})
+				}
+			}
+			// pools without stock are left out of the count
+			for pool, stock := range last {
+				if _, ok := current[pool]; !ok && stock != 0 {
+					bus.publish(EventStockChanged, StockEvent{Pool: pool, Stock: 0})
+				}
+			}
+			last = current
+		}
+	}()
+}
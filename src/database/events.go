@@ -0,0 +1,126 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// events webhooks can subscribe to
+const (
+	EventKeyCreated       = "key.created"
+	EventKeyDisabled      = "key.disabled"
+	EventItemDispensed    = "item.dispensed"
+	EventRestockCompleted = "restock.completed"
+	EventItemReported     = "item.reported"
+)
+
+// Events are every event webhooks can subscribe to
+var Events = []string{EventKeyCreated, EventKeyDisabled, EventItemDispensed, EventRestockCompleted, EventItemReported}
+
+/*
+Event ~ The envelope every event is sent in, Data depends on the type of event
+*/
+type Event struct {
+	Id   string    `json:"id"`
+	Type string    `json:"event"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+type KeyEvent struct {
+	Owner    string `json:"owner"`
+	MaxBatch int    `json:"max_batch,omitempty"`
+	Quota    int    `json:"quota,omitempty"`
+	// ReplaceLimit is how many replacements the key may receive per day, 0 uses the server default
+	ReplaceLimit int      `json:"replace_limit,omitempty"`
+	Pools        []string `json:"pools,omitempty"`
+}
+
+type DispenseEvent struct {
+	Owner string          `json:"owner"`
+	Pool  string          `json:"pool"`
+	Kind  string          `json:"kind"`
+	Items []DispensedItem `json:"items"`
+}
+
+type DispensedItem struct {
+	DispenseId int    `json:"dispense_id"`
+	Email      string `json:"email"`
+	Batch      int64  `json:"batch,omitempty"`
+}
+
+type RestockEvent struct {
+	Owner    string `json:"owner,omitempty"`
+	Batch    int64  `json:"batch"`
+	Pool     string `json:"pool"`
+	Source   string `json:"source,omitempty"`
+	Total    int    `json:"total"`
+	Added    int    `json:"added"`
+	Rejected int    `json:"rejected"`
+}
+
+type ReportEvent struct {
+	Owner      string `json:"owner"`
+	ReportId   int    `json:"report_id"`
+	DispenseId int    `json:"dispense_id"`
+	Reason     string `json:"reason"`
+}
+
+/*
+IsValidEvent ~ Used to check if an event exists
+*/
+func IsValidEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+publishEvent ~ Used to pass an event to the event bus and queue it for every webhook subscribed to it.
+Events are published after the change they describe is committed, failing to publish one doesn't undo the change so it is only logged
+*/
+func (database *DatabaseConnection) publishEvent(eventType string, data any) {
+	bus.publish(eventType, data)
+
+	eventId, err := randomId()
+	if err != nil {
+		log.Println("error publishing", eventType, "event:", err)
+		return
+	}
+	payload, err := json.Marshal(Event{Id: eventId, Type: eventType, Time: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Println("error marshalling", eventType, "event:", err)
+		return
+	}
+	err = database.queueDeliveries(eventType, payload)
+	if err != nil {
+		log.Println("error queueing", eventType, "event:", err)
+	}
+}
+
+/*
+ownerOf ~ Used to get the owner of a key for an event, so events never give keys away
+*/
+func (database *DatabaseConnection) ownerOf(key string) string {
+	owner, err := database.GetOwnerFromKey(key)
+	if err != nil {
+		return ""
+	}
+	return owner
+}
+
+/*
+dispenseEvent ~ Used to build the event of alts dispensed to a key
+*/
+func (database *DatabaseConnection) dispenseEvent(key string, kind string, alts []Alt) DispenseEvent {
+	event := DispenseEvent{Owner: database.ownerOf(key), Kind: kind, Items: make([]DispensedItem, 0, len(alts))}
+	for _, alt := range alts {
+		event.Pool = alt.Pool
+		event.Items = append(event.Items, DispensedItem{DispenseId: alt.DispenseId, Email: alt.Email, Batch: alt.Batch})
+	}
+	return event
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+)
+
+// ExportFormats are the formats stock can be exported in
+var ExportFormats = []string{"text", "csv", "jsonl"}
+
+/*
+ExportOptions ~ What to export and how
+*/
+type ExportOptions struct {
+	// Pool limits the export to one pool, empty exports every pool
+	Pool string
+	// Batch limits the export to the alts of one import batch, 0 exports every batch
+	Batch int64
+	// Format is one of ExportFormats
+	Format string
+	// History also exports the alts that were dispensed
+	History bool
+	// Remove deletes the exported stock, only once everything was written
+	Remove bool
+	// Written is called once every row was written to make the export durable, like syncing and closing a file.
+	// Removed stock is only deleted when it returns no error
+	Written func() error
+}
+
+/*
+ExportRow ~ An alt in an export, either in stock or dispensed
+*/
+type ExportRow struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Pool      string `json:"pool"`
+	Status    string `json:"status"`
+	Dispensed int64  `json:"dispensed,omitempty"`
+}
+
+/*
+exportWriter ~ Writes export rows in one of the export formats
+*/
+type exportWriter interface {
+	write(row ExportRow) error
+	flush() error
+}
+
+type textExportWriter struct{ writer *bufio.Writer }
+
+func (export *textExportWriter) write(row ExportRow) error {
+	_, err := export.writer.WriteString(row.Email + ":" + row.Password + "\n")
+	return err
+}
+
+func (export *textExportWriter) flush() error {
+	return export.writer.Flush()
+}
+
+type csvExportWriter struct{ writer *csv.Writer }
+
+func (export *csvExportWriter) write(row ExportRow) error {
+	dispensed := ""
+	if row.Dispensed != 0 {
+		dispensed = strconv.FormatInt(row.Dispensed, 10)
+	}
+	return export.writer.Write([]string{row.Email, row.Password, row.Pool, row.Status, dispensed})
+}
+
+func (export *csvExportWriter) flush() error {
+	export.writer.Flush()
+	return export.writer.Error()
+}
+
+type jsonlExportWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (export *jsonlExportWriter) write(row ExportRow) error {
+	return export.encoder.Encode(row)
+}
+
+func (export *jsonlExportWriter) flush() error {
+	return export.writer.Flush()
+}
+
+/*
+IsValidExportFormat ~ Used to check if stock can be exported in a format
+*/
+func IsValidExportFormat(format string) bool {
+	for _, exportFormat := range ExportFormats {
+		if format == exportFormat {
+			return true
+		}
+	}
+	return false
+}
+
+func newExportWriter(format string, writer io.Writer) (exportWriter, error) {
+	buffered := bufio.NewWriter(writer)
+	switch format {
+	case "csv":
+		export := &csvExportWriter{writer: csv.NewWriter(buffered)}
+		return export, export.writer.Write([]string{"email", "password", "pool", "status", "dispensed"})
+	case "jsonl":
+		return &jsonlExportWriter{writer: buffered, encoder: json.NewEncoder(buffered)}, nil
+	}
+	return &textExportWriter{writer: buffered}, nil
+}
+
+// exportLeasePrefix starts the lease id that stock is reserved under while it is exported to be removed
+const exportLeasePrefix = "export:"
+
+/*
+ExportStock ~ Used to stream the alts in stock, and the dispensed alts if asked to, to the writer.
+Everything is read in one transaction so the export is consistent, the database is in WAL mode so writers can still commit
+while it streams to a slow client. Leased alts are not in stock so they are never exported.
+Stock that is removed is reserved first so nothing dispenses it during the export, and is only deleted once every row was written,
+the write lock is only held to reserve and delete it and not while the export streams. Returns the amount of rows exported
+*/
+func (database *DatabaseConnection) ExportStock(writer io.Writer, options ExportOptions) (int, error) {
+	export, err := newExportWriter(options.Format, writer)
+	if err != nil {
+		return 0, err
+	}
+
+	filter, args := exportFilter(options)
+	if !options.Remove {
+		exported, err := database.writeExport(export, "SELECT email, password, pool FROM altlist WHERE leaseid = ''"+filter+" ORDER BY id", args, options)
+		if err == nil && options.Written != nil {
+			err = options.Written()
+		}
+		return exported, err
+	}
+
+	reservation, err := randomId()
+	if err != nil {
+		return 0, err
+	}
+	reservation = exportLeasePrefix + reservation
+	_, err = database.Database.Exec("UPDATE altlist SET leaseid = ? WHERE leaseid = ''"+filter, append([]any{reservation}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	markStockChanged()
+
+	exported, err := database.writeExport(export, "SELECT email, password, pool FROM altlist WHERE leaseid = ? ORDER BY id", []any{reservation}, options)
+	if err == nil && options.Written != nil {
+		err = options.Written()
+	}
+	if err != nil {
+		// the reserved stock goes back into stock when the export couldn't be fully written
+		_, releaseErr := database.Database.Exec("UPDATE altlist SET leaseid = '' WHERE leaseid = ?", reservation)
+		if releaseErr != nil {
+			log.Println("error returning stock of a failed export:", releaseErr)
+		}
+		return exported, err
+	}
+
+	removed, err := database.Database.Exec("DELETE FROM altlist WHERE leaseid = ?", reservation)
+	if err != nil {
+		return exported, err
+	}
+	stock, err := removed.RowsAffected()
+	if err != nil {
+		return exported, err
+	}
+	log.Println(" [-] Removed", stock, "exported alts from stock")
+	return exported, nil
+}
+
+/*
+writeExport ~ Used to write the stock the query selects, and the dispensed alts if asked to, to the export in one read transaction
+*/
+func (database *DatabaseConnection) writeExport(export exportWriter, query string, args []any, options ExportOptions) (int, error) {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	exported, err := exportRows(tx, export, query, args, false)
+	if err != nil {
+		return exported, err
+	}
+
+	if options.History {
+		filter, args := exportFilter(options)
+		dispensed, err := exportRows(tx, export, "SELECT email, password, pool, dispensed FROM dispenses WHERE TRUE"+filter+" ORDER BY id", args, true)
+		exported += dispensed
+		if err != nil {
+			return exported, err
+		}
+	}
+
+	// the export has to be fully written before removed stock is gone for good
+	err = export.flush()
+	if err != nil {
+		return exported, err
+	}
+	return exported, tx.Commit()
+}
+
+/*
+ReleaseInterruptedExports ~ Used to put stock back that was reserved by an export which never finished because the server stopped
+*/
+func (database *DatabaseConnection) ReleaseInterruptedExports() error {
+	released, err := database.Database.Exec("UPDATE altlist SET leaseid = '' WHERE leaseid LIKE ?", exportLeasePrefix+"%")
+	if err != nil {
+		return err
+	}
+	amount, err := released.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if amount > 0 {
+		log.Println(" [~] Returned", amount, "alts of an interrupted export to stock")
+	}
+	return nil
+}
+
+/*
+exportFilter ~ Used to get the conditions and their arguments that limit an export to its pool and batch
+*/
+func exportFilter(options ExportOptions) (string, []any) {
+	filter := ""
+	var args []any
+	if options.Pool != "" {
+		filter += " AND pool = ?"
+		args = append(args, options.Pool)
+	}
+	if options.Batch != 0 {
+		filter += " AND batch = ?"
+		args = append(args, options.Batch)
+	}
+	return filter, args
+}
+
+/*
+exportRows ~ Used to write every row of the query to the export, dispensed rows also have the time they were dispensed
+*/
+func exportRows(tx *sql.Tx, export exportWriter, query string, args []any, dispensed bool) (int, error) {
+	result, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	exported := 0
+	for result.Next() {
+		row := ExportRow{Status: "stock"}
+		if dispensed {
+			row.Status = "dispensed"
+			err = result.Scan(&row.Email, &row.Password, &row.Pool, &row.Dispensed)
+		} else {
+			err = result.Scan(&row.Email, &row.Password, &row.Pool)
+		}
+		if err != nil {
+			return exported, err
+		}
+		row.Password, err = decryptPassword(row.Password)
+		if err != nil {
+			return exported, err
+		}
+		err = export.write(row)
+		if err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	return exported, result.Err()
+}
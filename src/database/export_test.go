@@ -0,0 +1,65 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingWriter fails every write, like a client that went away
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+func TestExportRemove(t *testing.T) {
+	database := newTestDatabase(t)
+	restockTest(t, database, "export", "export", 5)
+	restockTest(t, database, "kept", "kept", 2)
+
+	// stock of a failed export goes back into stock
+	_, err := database.ExportStock(failingWriter{}, ExportOptions{Pool: "export", Format: "text", Remove: true})
+	if err == nil {
+		t.Fatal("export to a failing writer succeeded")
+	}
+	stock, err := database.GetPoolStockAmount("export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 5 {
+		t.Fatalf("%d alts in stock after a failed export, want 5", stock)
+	}
+
+	// so does the stock of an export that was written but couldn't be made durable
+	_, err = database.ExportStock(&bytes.Buffer{}, ExportOptions{Pool: "export", Format: "text", Remove: true, Written: func() error {
+		return errors.New("disk full")
+	}})
+	if err == nil {
+		t.Fatal("export that couldn't be made durable succeeded")
+	}
+	stock, err = database.GetPoolStockAmount("export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 5 {
+		t.Fatalf("%d alts in stock after an export that couldn't be made durable, want 5", stock)
+	}
+
+	var output bytes.Buffer
+	exported, err := database.ExportStock(&output, ExportOptions{Pool: "export", Format: "text", Remove: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != 5 || strings.Count(output.String(), "\n") != 5 {
+		t.Fatalf("exported %d rows:\n%s", exported, output.String())
+	}
+	perPool, err := database.GetStockPerPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perPool["export"] != 0 || perPool["kept"] != 2 {
+		t.Fatalf("stock after the export is %v, want only the 2 kept alts", perPool)
+	}
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"strings"
+)
+
+/*
+Fingerprint ~ Used to get the fingerprint an alt is deduplicated by, the sha256 of its lowercase email
+*/
+func Fingerprint(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+BackfillFingerprints ~ Used to fingerprint the alts in stock and dispense history when the fingerprint table is still empty
+*/
+func (database *DatabaseConnection) BackfillFingerprints() error {
+	filled, err := exists(database.Database, "SELECT 1 FROM fingerprints LIMIT 1")
+	if err != nil || filled {
+		return err
+	}
+
+	result, err := database.Database.Query("SELECT email FROM altlist UNION SELECT email FROM dispenses")
+	if err != nil {
+		return err
+	}
+	var emails []string
+	for result.Next() {
+		var email string
+		err = result.Scan(&email)
+		if err != nil {
+			_ = result.Close()
+			return err
+		}
+		emails = append(emails, email)
+	}
+	_ = result.Close()
+	if err = result.Err(); err != nil {
+		return err
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	insert, err := tx.Prepare("INSERT OR IGNORE INTO fingerprints (fingerprint) VALUES (?)")
+	if err != nil {
+		return err
+	}
+	defer func(insert *sql.Stmt) {
+		_ = insert.Close()
+	}(insert)
+	for _, email := range emails {
+		_, err = insert.Exec(Fingerprint(email))
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	log.Println("Fingerprinted", len(emails), "previously imported alts")
+	return nil
+}
@@ -0,0 +1,343 @@
+package database
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ImportFormats are the formats an import can be read in
+var ImportFormats = []string{"colon", "csv", "json", "jsonl"}
+
+// ItemsFormat reads a json object with an items array, used for restocks posted straight as json
+const ItemsFormat = "items"
+
+/*
+ImportItem ~ A single alt read from an import, Pool overrides the pool of the import when set
+*/
+type ImportItem struct {
+	Line     int
+	Email    string
+	Password string
+	Pool     string
+}
+
+/*
+MalformedError ~ Returned by an ItemReader for an entry that could not be parsed, reading can continue after it
+*/
+type MalformedError struct {
+	Line   int
+	Reason string
+}
+
+func (err *MalformedError) Error() string {
+	return "line " + strconv.Itoa(err.Line) + ": " + err.Reason
+}
+
+/*
+FormatError ~ Returned when an import can't be read in its format at all
+*/
+type FormatError struct {
+	Reason string
+}
+
+func (err *FormatError) Error() string {
+	return err.Reason
+}
+
+/*
+ItemReader ~ Reads alts from an import one at a time. Read returns io.EOF once there are no more items,
+a *MalformedError for an entry that could not be parsed, or any other error if the import can't be read further
+*/
+type ItemReader interface {
+	Read() (*ImportItem, error)
+}
+
+/*
+NewItemReader ~ Used to create the reader for an import format
+*/
+func NewItemReader(format string, reader io.Reader) (ItemReader, error) {
+	switch format {
+	case "", "colon":
+		return &colonReader{scanner: newLineScanner(reader)}, nil
+	case "csv":
+		return newCsvReader(reader)
+	case "json":
+		return newJsonReader(reader)
+	case "jsonl":
+		return &jsonLinesReader{scanner: newLineScanner(reader)}, nil
+	case ItemsFormat:
+		return newJsonItemsReader(reader)
+	}
+	return nil, &FormatError{Reason: "unknown import format " + format}
+}
+
+/*
+IsValidFormat ~ Used to check if an import format exists
+*/
+func IsValidFormat(format string) bool {
+	for _, importFormat := range ImportFormats {
+		if importFormat == format {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+DetectFormat ~ Used to guess the format of an import from its content type, falling back to the file extension
+*/
+func DetectFormat(contentType string, filename string) string {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(contentType)) {
+	case "text/csv":
+		return "csv"
+	case "application/json":
+		return "json"
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return "jsonl"
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	return "colon"
+}
+
+func newLineScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), MaxLineLength)
+	return scanner
+}
+
+/*
+checkItem ~ Used to make sure an item has both an email and a password
+*/
+func checkItem(item *ImportItem) error {
+	if item.Email == "" || item.Password == "" {
+		return &MalformedError{Line: item.Line, Reason: "missing email or password"}
+	}
+	return nil
+}
+
+/*
+colonReader ~ Reads email:password lines, splitting on the first colon so passwords may contain colons and spaces
+*/
+type colonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (reader *colonReader) Read() (*ImportItem, error) {
+	for reader.scanner.Scan() {
+		reader.line++
+		combo := strings.TrimRight(reader.scanner.Text(), "\r")
+		if strings.TrimSpace(combo) == "" {
+			continue
+		}
+		email, password, found := strings.Cut(combo, ":")
+		if !found {
+			return nil, &MalformedError{Line: reader.line, Reason: "missing ':' separator"}
+		}
+		item := &ImportItem{Line: reader.line, Email: strings.TrimSpace(email), Password: password}
+		return item, checkItem(item)
+	}
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+/*
+csvReader ~ Reads csv files with a header row, mapping the email, password and pool columns by name
+*/
+type csvReader struct {
+	reader   *csv.Reader
+	email    int
+	password int
+	pool     int
+}
+
+// csvColumns maps the accepted header names to the field they fill
+var csvColumns = map[string]string{
+	"email":    "email",
+	"mail":     "email",
+	"username": "email",
+	"user":     "email",
+	"login":    "email",
+	"password": "password",
+	"pass":     "password",
+	"pwd":      "password",
+	"pool":     "pool",
+}
+
+func newCsvReader(reader io.Reader) (*csvReader, error) {
+	csvFile := csv.NewReader(reader)
+	csvFile.FieldsPerRecord = -1
+	csvFile.LazyQuotes = true
+
+	header, err := csvFile.Read()
+	if err != nil {
+		return nil, &FormatError{Reason: "error reading csv header: " + err.Error()}
+	}
+	columns := &csvReader{reader: csvFile, email: -1, password: -1, pool: -1}
+	for i, name := range header {
+		switch csvColumns[strings.ToLower(strings.TrimSpace(name))] {
+		case "email":
+			columns.email = i
+		case "password":
+			columns.password = i
+		case "pool":
+			columns.pool = i
+		}
+	}
+	if columns.email == -1 || columns.password == -1 {
+		return nil, &FormatError{Reason: "csv header needs an email and password column"}
+	}
+	return columns, nil
+}
+
+func (reader *csvReader) Read() (*ImportItem, error) {
+	record, err := reader.reader.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return nil, &MalformedError{Line: parseError.Line, Reason: parseError.Err.Error()}
+		}
+		return nil, err
+	}
+	line, _ := reader.reader.FieldPos(0)
+
+	item := &ImportItem{Line: line}
+	if reader.email < len(record) {
+		item.Email = strings.TrimSpace(record[reader.email])
+	}
+	if reader.password < len(record) {
+		item.Password = record[reader.password]
+	}
+	if reader.pool != -1 && reader.pool < len(record) {
+		item.Pool = strings.TrimSpace(record[reader.pool])
+	}
+	return item, checkItem(item)
+}
+
+// jsonItem is a single alt in json and jsonl imports
+type jsonItem struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Pool     string `json:"pool"`
+}
+
+/*
+jsonReader ~ Reads a json array of items one element at a time, the line of each item is its position in the array
+*/
+type jsonReader struct {
+	decoder *json.Decoder
+	index   int
+}
+
+func newJsonReader(reader io.Reader) (*jsonReader, error) {
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, &FormatError{Reason: "error reading json: " + err.Error()}
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, &FormatError{Reason: "json import has to be an array of items"}
+	}
+	return &jsonReader{decoder: decoder}, nil
+}
+
+/*
+newJsonItemsReader ~ Used to read the items array of a json object, skipping over any other fields before it
+*/
+func newJsonItemsReader(reader io.Reader) (*jsonReader, error) {
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, &FormatError{Reason: "error reading json: " + err.Error()}
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, &FormatError{Reason: "json body has to be an object with an items array"}
+	}
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, &FormatError{Reason: "error reading json: " + err.Error()}
+		}
+		if token != "items" {
+			var skipped json.RawMessage
+			err = decoder.Decode(&skipped)
+			if err != nil {
+				return nil, &FormatError{Reason: "error reading json: " + err.Error()}
+			}
+			continue
+		}
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, &FormatError{Reason: "error reading json: " + err.Error()}
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, &FormatError{Reason: "items has to be an array"}
+		}
+		return &jsonReader{decoder: decoder}, nil
+	}
+	return nil, &FormatError{Reason: "json body has no items array"}
+}
+
+func (reader *jsonReader) Read() (*ImportItem, error) {
+	if !reader.decoder.More() {
+		return nil, io.EOF
+	}
+	reader.index++
+	var entry jsonItem
+	err := reader.decoder.Decode(&entry)
+	if err != nil {
+		// a value of the wrong type is skipped by the decoder, anything else means the json is broken
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			return nil, &MalformedError{Line: reader.index, Reason: err.Error()}
+		}
+		return nil, &FormatError{Reason: "error reading json item " + strconv.Itoa(reader.index) + ": " + err.Error()}
+	}
+	item := &ImportItem{Line: reader.index, Email: strings.TrimSpace(entry.Email), Password: entry.Password, Pool: entry.Pool}
+	return item, checkItem(item)
+}
+
+/*
+jsonLinesReader ~ Reads one json item per line
+*/
+type jsonLinesReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (reader *jsonLinesReader) Read() (*ImportItem, error) {
+	for reader.scanner.Scan() {
+		reader.line++
+		text := strings.TrimSpace(reader.scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry jsonItem
+		err := json.Unmarshal([]byte(text), &entry)
+		if err != nil {
+			return nil, &MalformedError{Line: reader.line, Reason: err.Error()}
+		}
+		item := &ImportItem{Line: reader.line, Email: strings.TrimSpace(entry.Email), Password: entry.Password, Pool: entry.Pool}
+		return item, checkItem(item)
+	}
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
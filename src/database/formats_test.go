@@ -0,0 +1,125 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+readResult ~ Everything an ItemReader read from an import, items are written as email:password or email:password@pool
+*/
+type readResult struct {
+	items     []string
+	malformed []int
+	// failed is set when reading stopped on an error that isn't a malformed entry
+	failed bool
+}
+
+func readImport(format string, input string) (readResult, error) {
+	var result readResult
+	items, err := NewItemReader(format, strings.NewReader(input))
+	if err != nil {
+		return result, err
+	}
+	for {
+		item, err := items.Read()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		var malformed *MalformedError
+		if errors.As(err, &malformed) {
+			result.malformed = append(result.malformed, malformed.Line)
+			continue
+		}
+		if err != nil {
+			result.failed = true
+			return result, err
+		}
+		combo := item.Email + ":" + item.Password
+		if item.Pool != "" {
+			combo += "@" + item.Pool
+		}
+		result.items = append(result.items, combo)
+	}
+}
+
+func TestItemReaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   readResult
+		// formatError is set when the import can't be read in its format at all
+		formatError bool
+	}{
+		{name: "colon", format: "colon", input: "a@x.com:one\nb@x.com:two\n",
+			want: readResult{items: []string{"a@x.com:one", "b@x.com:two"}}},
+		{name: "colon splits on the first colon", format: "colon", input: "a@x.com:pa:ss:word\n",
+			want: readResult{items: []string{"a@x.com:pa:ss:word"}}},
+		{name: "colon crlf", format: "colon", input: "a@x.com:one\r\nb@x.com:two\r\n",
+			want: readResult{items: []string{"a@x.com:one", "b@x.com:two"}}},
+		{name: "colon skips blank lines", format: "colon", input: "\na@x.com:one\n  \r\nb@x.com:two",
+			want: readResult{items: []string{"a@x.com:one", "b@x.com:two"}}},
+		{name: "colon trims the email only", format: "colon", input: " a@x.com : two words \n",
+			want: readResult{items: []string{"a@x.com: two words "}}},
+		{name: "colon malformed lines", format: "colon", input: "a@x.com:one\nno separator\nb@x.com:\n:three\nc@x.com:four\n",
+			want: readResult{items: []string{"a@x.com:one", "c@x.com:four"}, malformed: []int{2, 3, 4}}},
+
+		{name: "csv header mapping", format: "csv", input: "Password,Email,Pool\none,a@x.com,\ntwo,b@x.com,vip\n",
+			want: readResult{items: []string{"a@x.com:one", "b@x.com:two@vip"}}},
+		{name: "csv header aliases", format: "csv", input: "user,pass\na@x.com,one\n",
+			want: readResult{items: []string{"a@x.com:one"}}},
+		{name: "csv quoted fields", format: "csv", input: "email,password\n\"a@x.com\",\"p,\"\"q\"\"\"\n\"b@x.com\",\"multi\nline\"\n",
+			want: readResult{items: []string{"a@x.com:p,\"q\"", "b@x.com:multi\nline"}}},
+		{name: "csv crlf", format: "csv", input: "email,password\r\na@x.com,one\r\n",
+			want: readResult{items: []string{"a@x.com:one"}}},
+		{name: "csv missing columns", format: "csv", input: "email,password\na@x.com\n,two\nc@x.com,three\n",
+			want: readResult{items: []string{"c@x.com:three"}, malformed: []int{2, 3}}},
+		{name: "csv header without password", format: "csv", input: "email,name\na@x.com,a\n", formatError: true},
+		{name: "csv empty", format: "csv", input: "", formatError: true},
+
+		{name: "json", format: "json", input: `[{"email":"a@x.com","password":"one"},{"email":"b@x.com","password":"two","pool":"vip"}]`,
+			want: readResult{items: []string{"a@x.com:one", "b@x.com:two@vip"}}},
+		{name: "json wrong type mid-stream", format: "json", input: `[{"email":"a@x.com","password":"one"},{"email":5,"password":"two"},{"email":"c@x.com","password":"three"}]`,
+			want: readResult{items: []string{"a@x.com:one", "c@x.com:three"}, malformed: []int{2}}},
+		{name: "json missing password", format: "json", input: `[{"email":"a@x.com"},{"email":"b@x.com","password":"two"}]`,
+			want: readResult{items: []string{"b@x.com:two"}, malformed: []int{1}}},
+		{name: "json broken object mid-stream", format: "json", input: `[{"email":"a@x.com","password":"one"},{"email":"b@x.com",password},{"email":"c@x.com","password":"three"}]`,
+			want: readResult{items: []string{"a@x.com:one"}, failed: true}},
+		{name: "json not an array", format: "json", input: `{"email":"a@x.com","password":"one"}`, formatError: true},
+
+		{name: "jsonl", format: "jsonl", input: "{\"email\":\"a@x.com\",\"password\":\"one\"}\r\n\n{\"email\":\"b@x.com\",\"password\":\"two\",\"pool\":\"vip\"}\n",
+			want: readResult{items: []string{"a@x.com:one", "b@x.com:two@vip"}}},
+		{name: "jsonl bad object mid-stream", format: "jsonl", input: "{\"email\":\"a@x.com\",\"password\":\"one\"}\n{\"email\":\"b@x.com\",\n{\"email\":\"c@x.com\",\"password\":\"three\"}\n",
+			want: readResult{items: []string{"a@x.com:one", "c@x.com:three"}, malformed: []int{2}}},
+
+		{name: "items", format: ItemsFormat, input: `{"note":{"skipped":[1,2]},"items":[{"email":"a@x.com","password":"one"}]}`,
+			want: readResult{items: []string{"a@x.com:one"}}},
+		{name: "items missing", format: ItemsFormat, input: `{"note":"no items"}`, formatError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readImport(test.format, test.input)
+			var formatError *FormatError
+			if test.formatError {
+				if !errors.As(err, &formatError) {
+					t.Fatalf("got error %v, want a FormatError", err)
+				}
+				return
+			}
+			if err != nil && !test.want.failed {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if test.want.failed && !errors.As(err, &formatError) {
+				t.Fatalf("got error %v, want a FormatError mid-stream", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"database/sql"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"strings"
 )
 
 var (
 	Connection       *DatabaseConnection
 	GenerateCooldown int64
+	DataFolder       string
 )
 
 /*
@@ -16,9 +18,10 @@ Startup ~ Used to start up the database and create the apikey table if it doesn'
 */
 func Startup(dataFolder string, generateCooldown int) error {
 	GenerateCooldown = int64(generateCooldown)
+	DataFolder = dataFolder
 
-	// open connection to the database
-	conn, err := sql.Open("sqlite3", dataFolder+"/database.sqlite")
+	// open connection to the database, in WAL mode so long reads like exports don't keep writers from committing
+	conn, err := sql.Open(driverName, dataFolder+"/database.sqlite?_busy_timeout=5000&_journal_mode=WAL")
 	if err != nil {
 		return err
 	}
@@ -37,11 +40,91 @@ func Startup(dataFolder string, generateCooldown int) error {
 	if err != nil {
 		return err
 	}
+	err = Connection.CreateLeaseTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateDispenseTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateReportTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreatePoolTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateJobTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateFingerprintTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateBatchTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateAuditTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateDataKeyTable()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateWebhookTables()
+	if err != nil {
+		return err
+	}
+	// add any columns that were introduced after the tables were first created
+	err = Connection.MigrateColumns()
+	if err != nil {
+		return err
+	}
+	err = Connection.CreateIndexes()
+	if err != nil {
+		return err
+	}
+	// unlock the keys passwords are encrypted with before anything reads them
+	err = Connection.SetupEncryption()
+	if err != nil {
+		return err
+	}
+	// fingerprint everything that was imported before fingerprints existed
+	err = Connection.BackfillFingerprints()
+	if err != nil {
+		return err
+	}
 	key, err := Connection.CreateAdminUser()
 	if err != nil {
 		return err
 	}
 	log.Println("Created admin user with key:", key)
 
+	// jobs that were still going when the server stopped will never finish
+	err = Connection.FailInterruptedJobs()
+	if err != nil {
+		return err
+	}
+	err = Connection.FailInterruptedBatches()
+	if err != nil {
+		return err
+	}
+	err = Connection.ReleaseInterruptedExports()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+/*
+isUniqueError ~ Used to check if an error was caused by a UNIQUE constraint
+*/
+func isUniqueError(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+/*
+Ping ~ Used to check the database can still be reached
+*/
+func (database *DatabaseConnection) Ping(ctx context.Context) error {
+	return database.Database.PingContext(ctx)
+}
+
+/*
+CheckMigrations ~ Used to check every column from columnMigrations exists, a missing column means the schema is out of date
+*/
+func (database *DatabaseConnection) CheckMigrations() error {
+	for _, migration := range columnMigrations {
+		exists, err := database.hasColumn(migration.table, migration.column)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("missing column " + migration.table + "." + migration.column)
+		}
+	}
+	return nil
+}
+
+/*
+CheckDataFolder ~ Used to check files can still be written to the data folder
+*/
+func CheckDataFolder() error {
+	file, err := os.CreateTemp(DataFolder, ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	return os.Remove(filepath.Clean(file.Name()))
+}
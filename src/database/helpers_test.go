@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/*
+newTestDatabase ~ Used to start up a fresh database in a temp folder for a test
+*/
+func newTestDatabase(t testing.TB) *DatabaseConnection {
+	t.Helper()
+	return newTestDatabaseIn(t, t.TempDir())
+}
+
+/*
+newTestDatabaseIn ~ Used to start up the database in a folder, for tests that start up the same database again
+*/
+func newTestDatabaseIn(t testing.TB, folder string) *DatabaseConnection {
+	t.Helper()
+	err := Startup(folder, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := Connection
+	t.Cleanup(func() {
+		_ = connection.Database.Close()
+	})
+	return connection
+}
+
+/*
+testKey ~ Used to add a key with a quota to the test database
+*/
+func testKey(t testing.TB, database *DatabaseConnection, key string, quota int) {
+	t.Helper()
+	_, err := database.Database.Exec("INSERT INTO apikeys (apikey, owner, quota) VALUES (?, ?, ?)", key, key, quota)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+restockTest ~ Used to add count alts to a pool, their emails start with the prefix
+*/
+func restockTest(t *testing.T, database *DatabaseConnection, pool string, prefix string, count int) {
+	t.Helper()
+	var lines []string
+	for i := 0; i < count; i++ {
+		lines = append(lines, fmt.Sprintf("%s%d@example.com:p", prefix, i))
+	}
+	_, err := database.AddAccountsFromFile(strings.NewReader(strings.Join(lines, "\n")), ImportOptions{Pool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// inbox folders, files dropped in the inbox are moved to working while they are imported and to processed or failed after,
+// or removed when passwords are encrypted
+const (
+	InboxFolder     = "inbox"
+	workingFolder   = "working"
+	processedFolder = "processed"
+	failedFolder    = "failed"
+)
+
+/*
+inboxFile ~ The size and modification time a file in the inbox had on the last poll
+*/
+type inboxFile struct {
+	size    int64
+	modTime time.Time
+}
+
+/*
+InboxReport ~ The sidecar written next to every file the inbox picked up
+*/
+type InboxReport struct {
+	File     string         `json:"file"`
+	Pool     string         `json:"pool"`
+	Format   string         `json:"format"`
+	Imported time.Time      `json:"imported"`
+	Error    string         `json:"error,omitempty"`
+	Report   *RestockReport `json:"report,omitempty"`
+}
+
+/*
+StartInboxWatcher ~ Used to poll the inbox in the data folder and import the files dropped in it.
+Files in the inbox go to the default pool, files in a subfolder go to the pool named after it.
+A file is only imported once it stopped changing between two polls, so uploads in progress are left alone
+*/
+func (database *DatabaseConnection) StartInboxWatcher(interval time.Duration) error {
+	inbox := filepath.Join(DataFolder, InboxFolder)
+	for _, folder := range []string{inbox, filepath.Join(inbox, workingFolder), filepath.Join(inbox, processedFolder), filepath.Join(inbox, failedFolder)} {
+		err := os.MkdirAll(folder, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	failInterruptedInboxFiles(inbox)
+
+	go func() {
+		seen := map[string]inboxFile{}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			seen = database.pollInbox(inbox, seen)
+		}
+	}()
+	return nil
+}
+
+/*
+pollInbox ~ Used to import the files that didn't change since the last poll, returns the files to check again next poll
+*/
+func (database *DatabaseConnection) pollInbox(inbox string, seen map[string]inboxFile) map[string]inboxFile {
+	pending := map[string]inboxFile{}
+	for path, pool := range inboxFiles(inbox) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		current := inboxFile{size: info.Size(), modTime: info.ModTime()}
+		if last, ok := seen[path]; !ok || last != current {
+			pending[path] = current
+			continue
+		}
+		database.importInboxFile(inbox, path, pool)
+	}
+	return pending
+}
+
+/*
+inboxFiles ~ Used to list the files waiting in the inbox along with the pool they go to
+*/
+func inboxFiles(inbox string) map[string]string {
+	files := map[string]string{}
+	entries, err := os.ReadDir(inbox)
+	if err != nil {
+		log.Println("error reading inbox:", err)
+		return files
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		// hidden files are usually temporary files of an upload in progress
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if !entry.IsDir() {
+			files[filepath.Join(inbox, name)] = "default"
+			continue
+		}
+		if name == workingFolder || name == processedFolder || name == failedFolder || !IsValidPoolName(name) {
+			continue
+		}
+		poolEntries, err := os.ReadDir(filepath.Join(inbox, name))
+		if err != nil {
+			log.Println("error reading inbox pool folder:", err)
+			continue
+		}
+		for _, poolEntry := range poolEntries {
+			if !poolEntry.IsDir() && !strings.HasPrefix(poolEntry.Name(), ".") {
+				files[filepath.Join(inbox, name, poolEntry.Name())] = name
+			}
+		}
+	}
+	return files
+}
+
+/*
+importInboxFile ~ Used to import a file from the inbox and move it to processed or failed along with its report.
+The file is moved out of the inbox before it is imported, so it can't be imported again when it can't be moved after
+*/
+func (database *DatabaseConnection) importInboxFile(inbox string, path string, pool string) {
+	prefix, err := randomId()
+	if err != nil {
+		log.Println("error claiming inbox file:", err)
+		return
+	}
+	working := filepath.Join(inbox, workingFolder, prefix+"-"+filepath.Base(path))
+	err = os.Rename(path, working)
+	if err != nil {
+		// nothing was imported yet, the file is tried again on the next poll
+		log.Println("error claiming inbox file:", err)
+		return
+	}
+
+	options := ImportOptions{
+		Pool:    pool,
+		Key:     "inbox",
+		Source:  filepath.Base(path),
+		Format:  DetectFormat("", path),
+		Details: true,
+	}
+	result := InboxReport{
+		File:   filepath.Base(path),
+		Pool:   pool,
+		Format: options.Format,
+	}
+
+	file, err := os.Open(working)
+	if err == nil {
+		result.Report, err = database.ImportAccounts(file, options)
+		_ = file.Close()
+	}
+	result.Imported = time.Now().UTC()
+
+	if err != nil {
+		result.Error = err.Error()
+		log.Println(" [!] Failed to import", path+":", err)
+	} else {
+		log.Println(" [+] Imported", result.Report.Added, "alts from", path, "into pool", pool)
+	}
+	finishInboxFile(inbox, working, result)
+}
+
+/*
+finishInboxFile ~ Used to move a file out of the working folder into processed or failed and write its report next to it
+*/
+func finishInboxFile(inbox string, working string, result InboxReport) {
+	destination := filepath.Join(inbox, processedFolder)
+	if result.Error != "" {
+		destination = filepath.Join(inbox, failedFolder)
+	}
+
+	// prefix the name with the time so files dropped twice with the same name don't overwrite each other
+	target := filepath.Join(destination, result.Imported.Format("20060102-150405")+"-"+result.File)
+	var err error
+	if passwordKeys != nil {
+		// with encryption on the file is removed so the passwords aren't kept on disk in plaintext, only its report is kept
+		err = os.Remove(working)
+	} else {
+		err = os.Rename(working, target)
+	}
+	if err != nil {
+		// the file stays in the working folder, which isn't polled, so it isn't imported twice
+		log.Println("error moving inbox file:", err)
+	}
+
+	reportPayload, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Println("error marshalling inbox report:", err)
+		return
+	}
+	err = os.WriteFile(target+".report.json", reportPayload, 0644)
+	if err != nil {
+		log.Println("error writing inbox report:", err)
+	}
+}
+
+/*
+failInterruptedInboxFiles ~ Used on startup to move the files that were being imported when the server stopped to failed,
+part of them may be in stock already so they aren't imported again
+*/
+func failInterruptedInboxFiles(inbox string) {
+	entries, err := os.ReadDir(filepath.Join(inbox, workingFolder))
+	if err != nil {
+		log.Println("error reading inbox working folder:", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// the working name is the random prefix the file was claimed with followed by its name
+		_, name, _ := strings.Cut(entry.Name(), "-")
+		log.Println(" [!] Import of inbox file", name, "was interrupted by a restart")
+		finishInboxFile(inbox, filepath.Join(inbox, workingFolder, entry.Name()), InboxReport{
+			File:     name,
+			Imported: time.Now().UTC(),
+			Error:    "interrupted by restart",
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInboxFileImportedOnceWhenMoveFails(t *testing.T) {
+	database := newTestDatabase(t)
+	err := database.StartInboxWatcher(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(DataFolder, InboxFolder)
+
+	// without the processed folder moving the imported file there fails
+	err = os.Remove(filepath.Join(inbox, processedFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(inbox, "alts.txt"), []byte("inbox@example.com:p"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]inboxFile{}
+	for i := 0; i < 4; i++ {
+		seen = database.pollInbox(inbox, seen)
+	}
+
+	var batches int
+	err = database.Database.QueryRow("SELECT COUNT(*) FROM batches").Scan(&batches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 1 {
+		t.Fatalf("inbox file imported %d times, want once", batches)
+	}
+	if len(inboxFiles(inbox)) != 0 {
+		t.Fatal("imported file is still waiting in the inbox")
+	}
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// importLock makes imports run one at a time, import jobs wait for it as queued
+var importLock sync.Mutex
+
+/*
+ImportAccounts ~ Used to import alts right away instead of as a job, it waits for imports that are running like jobs do
+*/
+func (database *DatabaseConnection) ImportAccounts(file io.Reader, options ImportOptions) (*RestockReport, error) {
+	importLock.Lock()
+	defer importLock.Unlock()
+	return database.AddAccountsFromFile(file, options)
+}
+
+/*
+countEntries ~ Used to count the entries of an import the way its report counts them, malformed entries included and
+blank lines or headers left out, so the total of a job matches what it processed once it is done.
+Counting stops at an entry that can't be read since the import stops there too
+*/
+func countEntries(format string, reader io.Reader) int {
+	items, err := NewItemReader(format, reader)
+	if err != nil {
+		return 0
+	}
+	entries := 0
+	for {
+		_, err = items.Read()
+		var malformed *MalformedError
+		if err != nil && !errors.As(err, &malformed) {
+			return entries
+		}
+		entries++
+	}
+}
+
+/*
+StartImportJob ~ Used to save an upload to the data folder and import it in the background, returning the job id straight away
+*/
+func (database *DatabaseConnection) StartImportJob(key string, source io.Reader, options ImportOptions) (string, error) {
+	jobId, err := randomId()
+	if err != nil {
+		return "", err
+	}
+
+	// the upload has to be saved since the request body is gone once the handler returns, it is encrypted while it waits
+	folder := filepath.Join(DataFolder, "jobs")
+	err = os.MkdirAll(folder, 0755)
+	if err != nil {
+		return "", err
+	}
+	uploadPath := filepath.Join(folder, jobId+".upload")
+	upload, err := os.Create(uploadPath)
+	if err != nil {
+		return "", err
+	}
+	spoolKey, err := spoolFile(upload, source)
+	_ = upload.Close()
+	if err != nil {
+		_ = os.Remove(uploadPath)
+		return "", err
+	}
+
+	_, err = database.Database.Exec("INSERT INTO jobs (id, apikey) VALUES (?, ?)", jobId, key)
+	if err != nil {
+		_ = os.Remove(uploadPath)
+		return "", err
+	}
+
+	go database.runImportJob(jobId, uploadPath, spoolKey, options)
+	return jobId, nil
+}
+
+func (database *DatabaseConnection) runImportJob(jobId string, uploadPath string, spoolKey []byte, options ImportOptions) {
+	importLock.Lock()
+	defer importLock.Unlock()
+	defer func() {
+		_ = os.Remove(uploadPath)
+	}()
+
+	upload, err := os.Open(uploadPath)
+	if err != nil {
+		database.finishJob(jobId, nil, err)
+		return
+	}
+	defer func(upload *os.File) {
+		_ = upload.Close()
+	}(upload)
+
+	// the upload is read once to count its entries before it is imported
+	reader, err := newSpoolReader(upload, spoolKey)
+	if err != nil {
+		database.finishJob(jobId, nil, err)
+		return
+	}
+	total := countEntries(options.Format, reader)
+	_, err = upload.Seek(0, io.SeekStart)
+	if err != nil {
+		database.finishJob(jobId, nil, err)
+		return
+	}
+	reader.pending = nil
+	_, err = database.Database.Exec("UPDATE jobs SET status = 'running', total = ? WHERE id = ?", total, jobId)
+	if err != nil {
+		log.Println("error starting import job:", err)
+	}
+
+	options.Progress = func(processed int) {
+		_, err := database.Database.Exec("UPDATE jobs SET processed = ? WHERE id = ?", processed, jobId)
+		if err != nil {
+			log.Println("error updating import job progress:", err)
+		}
+	}
+	report, err := database.AddAccountsFromFile(reader, options)
+	database.finishJob(jobId, report, err)
+}
+
+func (database *DatabaseConnection) finishJob(jobId string, report *RestockReport, jobError error) {
+	var err error
+	if jobError != nil {
+		log.Println("import job", jobId, "failed:", jobError)
+		// the report of a failed import tells how many alts made it into stock before it failed
+		reportPayload := ""
+		var processed any
+		if report != nil {
+			marshalled, marshalError := json.Marshal(report)
+			if marshalError != nil {
+				log.Println("error marshalling import job report:", marshalError)
+			}
+			reportPayload = string(marshalled)
+			processed = report.Total
+		}
+		// jobs that failed without a report keep the progress they last recorded
+		_, err = database.Database.Exec("UPDATE jobs SET status = 'failed', error = ?, report = ?, processed = COALESCE(?, processed), finished = ? WHERE id = ?",
+			jobError.Error(), reportPayload, processed, time.Now().Unix(), jobId)
+	} else {
+		reportPayload, marshalError := json.Marshal(report)
+		if marshalError != nil {
+			log.Println("error marshalling import job report:", marshalError)
+		}
+		_, err = database.Database.Exec("UPDATE jobs SET status = 'done', processed = ?, report = ?, finished = ? WHERE id = ?",
+			report.Total, string(reportPayload), time.Now().Unix(), jobId)
+	}
+	if err != nil {
+		log.Println("error finishing import job:", err)
+	}
+}
+
+/*
+FailInterruptedJobs ~ Used on startup to fail jobs that were queued or running when the server stopped
+*/
+func (database *DatabaseConnection) FailInterruptedJobs() error {
+	_, err := database.Database.Exec("UPDATE jobs SET status = 'failed', error = 'interrupted by restart', finished = ? WHERE status IN ('queued', 'running')",
+		time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	// their uploads are never going to be read again
+	uploads, _ := filepath.Glob(filepath.Join(DataFolder, "jobs", "*.upload"))
+	for _, upload := range uploads {
+		_ = os.Remove(upload)
+	}
+	return nil
+}
+
+const jobColumns = "id, status, processed, total, report, error, created, finished"
+
+func scanJob(row interface{ Scan(...any) error }) (*Job, error) {
+	var job Job
+	var report string
+	err := row.Scan(&job.Id, &job.Status, &job.Processed, &job.Total, &report, &job.Error, &job.Created, &job.Finished)
+	if err != nil {
+		return nil, err
+	}
+	if report != "" {
+		job.Report = &RestockReport{}
+		err = json.Unmarshal([]byte(report), job.Report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+/*
+GetJob ~ Used to get an import job by its id
+*/
+func (database *DatabaseConnection) GetJob(jobId string) (*Job, error) {
+	job, err := scanJob(database.Database.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", jobId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+/*
+GetJobs ~ Used to get the most recent import jobs
+*/
+func (database *DatabaseConnection) GetJobs(limit int) ([]Job, error) {
+	result, err := database.Database.Query("SELECT "+jobColumns+" FROM jobs ORDER BY created DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	jobs := []Job{}
+	for result.Next() {
+		job, err := scanJob(result)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, result.Err()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+waitForJob ~ Used to wait until an import job is done or failed
+*/
+func waitForJob(t *testing.T, database *DatabaseConnection, jobId string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := database.GetJob(jobId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == "done" || job.Status == "failed" {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("import job didn't finish")
+	return nil
+}
+
+func TestFailedJobRecordsProcessed(t *testing.T) {
+	database := newTestDatabase(t)
+	upload := `[{"email": "a@example.com", "password": "p"}, {"email": "b@example.com", "password": "p"}, {"email": `
+	jobId, err := database.StartImportJob("test", strings.NewReader(upload), ImportOptions{Pool: "default", Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitForJob(t, database, jobId)
+	if job.Status != "failed" {
+		t.Fatalf("job %s, want failed", job.Status)
+	}
+	if job.Report == nil {
+		t.Fatal("failed job has no report")
+	}
+	if job.Processed != job.Report.Total {
+		t.Fatalf("failed job processed %d, its report has %d", job.Processed, job.Report.Total)
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrLeaseNotFound = errors.New("lease not found or expired")
+
+/*
+ConfirmLease ~ Used to confirm a key received the alts of a lease, removing them from stock for good
+*/
+func (database *DatabaseConnection) ConfirmLease(key string, leaseId string) ([]Alt, error) {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// the lease has to belong to the key and not have expired yet
+	deleted, err := tx.Exec("DELETE FROM leases WHERE id = ? AND apikey = ? AND expires >= ?", leaseId, key, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	affected, err := deleted.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrLeaseNotFound
+	}
+
+	result, err := tx.Query("DELETE FROM altlist WHERE leaseid = ? RETURNING "+altColumns, leaseId)
+	if err != nil {
+		return nil, err
+	}
+	alts, err := scanAlts(result)
+	if err != nil {
+		return nil, err
+	}
+	err = recordDispenses(tx, key, alts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	// only confirmed alts are counted, alts of expired leases go back into stock
+	countDispensed(alts, "lease")
+	database.publishEvent(EventItemDispensed, database.dispenseEvent(key, "lease", alts))
+	return alts, nil
+}
+
+/*
+ReleaseExpiredLeases ~ Used to put the alts of expired leases back into stock and refund the quota they used
+*/
+func (database *DatabaseConnection) ReleaseExpiredLeases() (int64, error) {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(`UPDATE apikeys SET uses = MAX(0, uses - (
+									SELECT COUNT(*) FROM altlist JOIN leases ON altlist.leaseid = leases.id
+									WHERE leases.apikey = apikeys.apikey AND leases.expires < ?))
+								WHERE apikey IN (SELECT apikey FROM leases WHERE expires < ?)`, now, now)
+	if err != nil {
+		return 0, err
+	}
+	// alts of rolled back batches don't go back into stock
+	_, err = tx.Exec(`DELETE FROM altlist WHERE leaseid IN (SELECT id FROM leases WHERE expires < ?)
+								AND batch IN (SELECT id FROM batches WHERE status = 'rolledback')`, now)
+	if err != nil {
+		return 0, err
+	}
+	released, err := tx.Exec("UPDATE altlist SET leaseid = '' WHERE leaseid IN (SELECT id FROM leases WHERE expires < ?)", now)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("DELETE FROM leases WHERE expires < ?", now)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return released.RowsAffected()
+}
+
+/*
+StartLeaseReaper ~ Used to periodically release expired leases in the background
+*/
+func (database *DatabaseConnection) StartLeaseReaper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			released, err := database.ReleaseExpiredLeases()
+			if err != nil {
+				log.Println("error releasing expired leases:", err)
+				continue
+			}
+			if released > 0 {
+				markStockChanged()
+				log.Println(" [~] Returned", released, "leased alts to stock")
+			}
+		}
+	}()
+}
+
+/*
+randomId ~ Used to generate a random hex id that is not guessable
+*/
+func randomId() (string, error) {
+	buffer := make([]byte, 16)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
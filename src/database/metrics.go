@@ -0,0 +1,177 @@
+package database
+
+import (
+	"DortgenAPI/src/metrics"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// driverName is the sqlite driver wrapped to time every query
+const driverName = "sqlite3_timed"
+
+var (
+	queryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dortgen_db_query_duration_seconds",
+		Help:    "Database query latency by kind of statement.",
+		Buckets: metrics.DefaultBuckets,
+	}, []string{"operation"})
+	dispensed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dortgen_dispensed_total",
+		Help: "Alts handed out by pool and how they were handed out.",
+	}, []string{"pool", "kind"})
+	restockLines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dortgen_restock_lines_total",
+		Help: "Restocked lines by outcome.",
+	}, []string{"outcome"})
+	stockDesc = prometheus.NewDesc("dortgen_stock", "Alts in stock by pool.", []string{"pool"}, nil)
+)
+
+func init() {
+	sql.Register(driverName, &timedDriver{})
+	prometheus.MustRegister(&stockCollector{reported: map[string]struct{}{}})
+}
+
+/*
+stockCollector ~ Collects the stock of every known pool when the metrics are scraped, pools that ran out report 0
+instead of disappearing so alerts on them keep working. Pools are remembered once reported, so a pool whose
+alts only ever came with their own pool in an import keeps reporting after its last alt is gone
+*/
+type stockCollector struct {
+	lock     sync.Mutex
+	reported map[string]struct{}
+}
+
+func (collector *stockCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- stockDesc
+}
+
+func (collector *stockCollector) Collect(collected chan<- prometheus.Metric) {
+	if Connection == nil {
+		return
+	}
+	pools, err := Connection.GetKnownPools()
+	if err != nil {
+		log.Println("error collecting dortgen_stock:", err)
+		return
+	}
+	stock, err := Connection.GetStockPerPool()
+	if err != nil {
+		log.Println("error collecting dortgen_stock:", err)
+		return
+	}
+
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	for _, pool := range pools {
+		collector.reported[pool] = struct{}{}
+	}
+	for pool := range stock {
+		collector.reported[pool] = struct{}{}
+	}
+	for pool := range collector.reported {
+		collected <- prometheus.MustNewConstMetric(stockDesc, prometheus.GaugeValue, float64(stock[pool]), pool)
+	}
+}
+
+/*
+countDispensed ~ Used to count alts in the dispense metrics once they were handed out
+*/
+func countDispensed(alts []Alt, kind string) {
+	for _, alt := range alts {
+		dispensed.WithLabelValues(alt.Pool, kind).Inc()
+	}
+}
+
+/*
+countRestock ~ Used to count the lines of a finished restock in the restock metrics
+*/
+func countRestock(report *RestockReport) {
+	restockLines.WithLabelValues("added").Add(float64(report.Added))
+	restockLines.WithLabelValues("duplicate").Add(float64(report.Duplicate))
+	restockLines.WithLabelValues("malformed").Add(float64(report.Malformed))
+	restockLines.WithLabelValues("failed").Add(float64(report.Failed))
+	for _, invalid := range report.Invalid {
+		restockLines.WithLabelValues("invalid").Add(float64(invalid))
+	}
+}
+
+/*
+operation ~ Used to get the kind of statement a query is, like select or insert, to label its latency with
+*/
+func operation(query string) string {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	switch keyword {
+	case "select", "insert", "update", "delete", "create", "alter", "pragma":
+		return keyword
+	}
+	return "other"
+}
+
+func observeQuery(query string, start time.Time) {
+	queryLatency.WithLabelValues(operation(query)).Observe(time.Since(start).Seconds())
+}
+
+/*
+timedDriver ~ The sqlite driver with every statement timed in the query latency metrics
+*/
+type timedDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (timed *timedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := timed.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (conn *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(query, time.Now())
+	return conn.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (conn *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return conn.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+func (conn *timedConn) Prepare(query string) (driver.Stmt, error) {
+	return conn.PrepareContext(context.Background(), query)
+}
+
+func (conn *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := conn.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{stmt.(*sqlite3.SQLiteStmt), query}, nil
+}
+
+type timedStmt struct {
+	*sqlite3.SQLiteStmt
+	query string
+}
+
+func (stmt *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(stmt.query, time.Now())
+	return stmt.SQLiteStmt.ExecContext(ctx, args)
+}
+
+func (stmt *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(stmt.query, time.Now())
+	return stmt.SQLiteStmt.QueryContext(ctx, args)
+}
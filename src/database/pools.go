@@ -0,0 +1,172 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+)
+
+var poolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+/*
+IsValidPoolName ~ Used to check a pool name only has letters, numbers, dashes and underscores
+*/
+func IsValidPoolName(pool string) bool {
+	return poolNamePattern.MatchString(pool)
+}
+
+// DefaultStrategy is the dispense strategy of pools without one set
+var DefaultStrategy = "fifo"
+
+// dispenseOrders maps each dispense strategy to the altlist ordering it dispenses in
+var dispenseOrders = map[string]string{
+	"fifo":     "id ASC",
+	"lifo":     "id DESC",
+	"random":   "RANDOM()",
+	"priority": "priority DESC, id ASC",
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+/*
+IsValidStrategy ~ Used to check if a dispense strategy exists
+*/
+func IsValidStrategy(strategy string) bool {
+	_, ok := dispenseOrders[strategy]
+	return ok
+}
+
+/*
+poolOrder ~ Used to get the ORDER BY clause for the dispense strategy of a pool
+*/
+func poolOrder(database queryRower, pool string) (string, error) {
+	strategy := DefaultStrategy
+	err := database.QueryRow("SELECT strategy FROM pools WHERE name = ?", pool).Scan(&strategy)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	order, ok := dispenseOrders[strategy]
+	if !ok {
+		return dispenseOrders["fifo"], nil
+	}
+	return order, nil
+}
+
+// poolColumns are the columns of pools read by scanPool
+const poolColumns = "name, strategy, emailcheck, minlength, maxlength, charset, pattern, lowstock, alerturl, alertformat"
+
+/*
+defaultPool ~ The settings of a pool that has never been changed
+*/
+func defaultPool(name string) Pool {
+	return Pool{
+		Name:        name,
+		Strategy:    DefaultStrategy,
+		MinLength:   1,
+		MaxLength:   256,
+		Charset:     "printable",
+		AlertFormat: "generic",
+	}
+}
+
+func scanPool(row interface{ Scan(...any) error }) (Pool, error) {
+	var pool Pool
+	err := row.Scan(&pool.Name, &pool.Strategy, &pool.EmailCheck, &pool.MinLength, &pool.MaxLength, &pool.Charset, &pool.Pattern,
+		&pool.LowStock, &pool.AlertURL, &pool.AlertFormat)
+	return pool, err
+}
+
+/*
+GetPool ~ Used to get the settings of a pool, pools without settings get the defaults
+*/
+func (database *DatabaseConnection) GetPool(name string) (Pool, error) {
+	pool, err := scanPool(database.Database.QueryRow("SELECT "+poolColumns+" FROM pools WHERE name = ?", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultPool(name), nil
+	}
+	return pool, err
+}
+
+/*
+SavePool ~ Used to save the dispense strategy, validation rules and low-stock alert of a pool
+*/
+func (database *DatabaseConnection) SavePool(pool Pool) error {
+	_, err := database.Database.Exec(`INSERT INTO pools (`+poolColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+										ON CONFLICT (name) DO UPDATE SET strategy = excluded.strategy, emailcheck = excluded.emailcheck,
+										minlength = excluded.minlength, maxlength = excluded.maxlength, charset = excluded.charset, pattern = excluded.pattern,
+										lowstock = excluded.lowstock, alerturl = excluded.alerturl, alertformat = excluded.alertformat`,
+		pool.Name, pool.Strategy, pool.EmailCheck, pool.MinLength, pool.MaxLength, pool.Charset, pool.Pattern, pool.LowStock, pool.AlertURL, pool.AlertFormat)
+	return err
+}
+
+/*
+GetKnownPools ~ Used to get the name of every pool that has settings, was restocked into or has alts, in stock or leased
+*/
+func (database *DatabaseConnection) GetKnownPools() ([]string, error) {
+	result, err := database.Database.Query("SELECT name FROM pools UNION SELECT pool FROM batches UNION SELECT pool FROM altlist ORDER BY 1")
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	var pools []string
+	for result.Next() {
+		var pool string
+		err = result.Scan(&pool)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, result.Err()
+}
+
+/*
+GetPools ~ Used to get every pool that has settings or stock, along with its settings and stock
+*/
+func (database *DatabaseConnection) GetPools() ([]Pool, error) {
+	stock, err := database.GetStockPerPool()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := database.Database.Query("SELECT " + poolColumns + " FROM pools")
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	pools := []Pool{}
+	saved := map[string]struct{}{}
+	for result.Next() {
+		pool, err := scanPool(result)
+		if err != nil {
+			return nil, err
+		}
+		pool.Stock = stock[pool.Name]
+		pools = append(pools, pool)
+		saved[pool.Name] = struct{}{}
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, amount := range stock {
+		if _, ok := saved[name]; !ok {
+			pool := defaultPool(name)
+			pool.Stock = amount
+			pools = append(pools, pool)
+		}
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+	return pools, nil
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrDispenseNotFound = errors.New("dispense not found")
+	ErrAlreadyReported  = errors.New("item already reported")
+	ErrReportNotFound   = errors.New("report not found")
+	ErrAlreadyReplaced  = errors.New("item already replaced")
+	ErrKeyDisabled      = errors.New("key disabled")
+	ErrPoolNotAllowed   = errors.New("key can not use the pool")
+)
+
+/*
+GetDispense ~ Used to get an alt that was dispensed to a key by its dispense id
+*/
+func (database *DatabaseConnection) GetDispense(key string, dispenseId int) (*Dispense, error) {
+	var dispense Dispense
+	err := database.Database.QueryRow("SELECT id, apikey, email, password, pool, dispensed FROM dispenses WHERE id = ? AND apikey = ?", dispenseId, key).
+		Scan(&dispense.Id, &dispense.ApiKey, &dispense.Email, &dispense.Password, &dispense.Pool, &dispense.Dispensed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDispenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	dispense.Password, err = decryptPassword(dispense.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &dispense, nil
+}
+
+/*
+CreateReport ~ Used to record a report against a dispensed alt, returning the id of the report
+*/
+func (database *DatabaseConnection) CreateReport(key string, dispenseId int, reason string) (int, error) {
+	var reportId int
+	err := database.Database.QueryRow("INSERT INTO reports (dispenseid, apikey, reason) VALUES (?, ?, ?) RETURNING id", dispenseId, key, reason).Scan(&reportId)
+	if err != nil && isUniqueError(err) {
+		return 0, ErrAlreadyReported
+	}
+	if err != nil {
+		return 0, err
+	}
+	database.publishEvent(EventItemReported, ReportEvent{Owner: database.ownerOf(key), ReportId: reportId, DispenseId: dispenseId, Reason: reason})
+	return reportId, nil
+}
+
+/*
+GetUnreplacedReport ~ Used to get the report a key made against a dispense if it didn't get a replacement yet, so the replacement
+can be asked for again when it couldn't be given with the report. Rejected reports don't get a replacement
+*/
+func (database *DatabaseConnection) GetUnreplacedReport(key string, dispenseId int) (int, error) {
+	var reportId, replacement int
+	err := database.Database.QueryRow("SELECT id, replacement FROM reports WHERE dispenseid = ? AND apikey = ? AND status != 'rejected'", dispenseId, key).
+		Scan(&reportId, &replacement)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrReportNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if replacement != 0 {
+		return 0, ErrAlreadyReplaced
+	}
+	return reportId, nil
+}
+
+/*
+ReplacementLimitError ~ Returned when a key already received as many replacements as it may per day
+*/
+type ReplacementLimitError struct {
+	Limit int
+}
+
+func (err *ReplacementLimitError) Error() string {
+	return "replacement limit reached (" + strconv.Itoa(err.Limit) + " per day)"
+}
+
+/*
+DispenseReplacement ~ Used to give a key a replacement alt from a pool for a report, without touching its cooldown or quota.
+Keys without their own replacement limit get defaultLimit replacements per day, a *ReplacementLimitError is returned once they are used up.
+Like generating, the key has to be enabled and allowed to use the pool, it may have lost either since the alt was dispensed
+*/
+func (database *DatabaseConnection) DispenseReplacement(key string, pool string, reportId int, defaultLimit int) (*Alt, error) {
+	order, tx, err := database.beginDispense(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	result, err := tx.Query("DELETE FROM altlist WHERE id IN (SELECT id FROM altlist WHERE leaseid = '' AND pool = ? ORDER BY "+order+" LIMIT 1) RETURNING "+altColumns, pool)
+	if err != nil {
+		return nil, err
+	}
+	alts, err := scanAlts(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(alts) == 0 {
+		return nil, ErrNotEnoughStock
+	}
+
+	// the key is checked once the delete holds the write lock, so concurrent reports of a key can't both get past the limit
+	var replacements, limit int
+	var disabled bool
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM reports WHERE apikey = ? AND replacement != 0 AND created >= ?), replacelimit, disabled
+						FROM apikeys WHERE apikey = ?`, key, time.Now().Add(-24*time.Hour).Unix(), key).Scan(&replacements, &limit, &disabled)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		return nil, ErrKeyDisabled
+	}
+	allowed, err := canUsePool(tx, key, pool)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrPoolNotAllowed
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if replacements >= limit {
+		return nil, &ReplacementLimitError{Limit: limit}
+	}
+
+	err = recordDispenses(tx, key, alts)
+	if err != nil {
+		return nil, err
+	}
+	// a report only gets one replacement, even when it is asked for again at the same time
+	updated, err := tx.Exec("UPDATE reports SET replacement = ? WHERE id = ? AND replacement = 0", alts[0].DispenseId, reportId)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := updated.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrAlreadyReplaced
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	markStockChanged()
+	countDispensed(alts, "replacement")
+	database.publishEvent(EventItemDispensed, database.dispenseEvent(key, "replacement", alts))
+	return &alts[0], nil
+}
+
+/*
+GetReports ~ Used to get the reports with the given status, or all reports if status is empty
+*/
+func (database *DatabaseConnection) GetReports(status string) ([]Report, error) {
+	result, err := database.Database.Query(`SELECT reports.id, reports.dispenseid, COALESCE(apikeys.owner, ''), dispenses.email, reports.reason,
+       											reports.created, reports.status, reports.replacement, reports.reviewed
+											FROM reports
+											JOIN dispenses ON dispenses.id = reports.dispenseid
+											LEFT JOIN apikeys ON apikeys.apikey = reports.apikey
+											WHERE ? = '' OR reports.status = ?
+											ORDER BY reports.id`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	reports := []Report{}
+	for result.Next() {
+		var report Report
+		err = result.Scan(&report.Id, &report.DispenseId, &report.Owner, &report.Email, &report.Reason,
+			&report.Created, &report.Status, &report.Replacement, &report.Reviewed)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, result.Err()
+}
+
+/*
+ReviewReport ~ Used by admins to set the status of a report
+*/
+func (database *DatabaseConnection) ReviewReport(reportId int, status string) error {
+	updated, err := database.Database.Exec("UPDATE reports SET status = ?, reviewed = ? WHERE id = ?", status, time.Now().Unix(), reportId)
+	if err != nil {
+		return err
+	}
+	affected, err := updated.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestReplacementLimit(t *testing.T) {
+	database := newTestDatabase(t)
+	testKey(t, database, "replace", 0)
+	_, err := database.Database.Exec("UPDATE apikeys SET replacelimit = 1 WHERE apikey = ?", "replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restockTest(t, database, "default", "replace", 10)
+	alts, err := database.DispenseAlts("replace", "default", 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every report asks for a replacement at once, the key's own limit of 1 lets only one through
+	var wait sync.WaitGroup
+	results := make([]error, len(alts))
+	for i, alt := range alts {
+		reportId, err := database.CreateReport("replace", alt.DispenseId, "broken")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait.Add(1)
+		go func(i int, reportId int) {
+			defer wait.Done()
+			_, results[i] = database.DispenseReplacement("replace", "default", reportId, 3)
+		}(i, reportId)
+	}
+	wait.Wait()
+
+	replaced := 0
+	for _, err := range results {
+		var limit *ReplacementLimitError
+		switch {
+		case err == nil:
+			replaced++
+		case !errors.As(err, &limit) || limit.Limit != 1:
+			t.Fatal(err)
+		}
+	}
+	if replaced != 1 {
+		t.Fatalf("%d replacements were given, want 1", replaced)
+	}
+}
+
+func TestReplacementChecksKey(t *testing.T) {
+	database := newTestDatabase(t)
+	testKey(t, database, "revoked", 0)
+	restockTest(t, database, "default", "revoked", 5)
+	alts, err := database.DispenseAlts("revoked", "default", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the key lost the pool after the alts were dispensed
+	_, err = database.Database.Exec("UPDATE apikeys SET pools = 'other' WHERE apikey = ?", "revoked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportId, err := database.CreateReport("revoked", alts[0].DispenseId, "broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = database.DispenseReplacement("revoked", "default", reportId, 3)
+	if !errors.Is(err, ErrPoolNotAllowed) {
+		t.Fatalf("got %v, want %v", err, ErrPoolNotAllowed)
+	}
+
+	_, err = database.Database.Exec("UPDATE apikeys SET pools = '', disabled = 1 WHERE apikey = ?", "revoked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = database.DispenseReplacement("revoked", "default", reportId, 3)
+	if !errors.Is(err, ErrKeyDisabled) {
+		t.Fatalf("got %v, want %v", err, ErrKeyDisabled)
+	}
+	stock, err := database.GetPoolStockAmount("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 3 {
+		t.Fatalf("%d alts in stock after refused replacements, want 3", stock)
+	}
+}
@@ -1,5 +1,7 @@
 package database
 
+import "database/sql"
+
 /*
 CreateApiKeyTable ~ Used to create the apikey table if it doesn't exist
 */
@@ -55,3 +57,241 @@ func (databaseConnection *DatabaseConnection) CreateAltListTable() error {
 	)
 	return err
 }
+
+func (databaseConnection *DatabaseConnection) CreateLeaseTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS leases(
+									id TEXT NOT NULL PRIMARY KEY UNIQUE, -- id of the lease given to the client
+									apikey TEXT NOT NULL, -- key that leased the alts
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now')), -- when the lease was created in unix seconds
+									expires INTEGER NOT NULL); -- when the alts return to stock in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateDispenseTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS dispenses(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the dispense given to the client
+									apikey TEXT NOT NULL, -- key the alt was dispensed to
+									email TEXT NOT NULL, -- email of the alt
+									password TEXT NOT NULL, -- password of the alt
+									dispensed INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))); -- when the alt was dispensed in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateReportTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS reports(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the report
+									dispenseid INTEGER NOT NULL UNIQUE, -- dispense that was reported
+									apikey TEXT NOT NULL, -- key that reported the alt
+									reason TEXT NOT NULL, -- why the alt was reported
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now')), -- when the report was made in unix seconds
+									status TEXT NOT NULL DEFAULT 'open', -- open, resolved or rejected
+									replacement INTEGER NOT NULL DEFAULT 0, -- dispense id of the replacement alt, 0 if none was given
+									reviewed INTEGER NOT NULL DEFAULT 0); -- when an admin reviewed the report in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreatePoolTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS pools(
+									name TEXT NOT NULL PRIMARY KEY UNIQUE, -- name of the pool
+									strategy TEXT NOT NULL DEFAULT 'fifo'); -- order alts are dispensed in, fifo, lifo, random or priority`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateJobTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS jobs(
+									id TEXT NOT NULL PRIMARY KEY UNIQUE, -- id of the job given to the uploader
+									apikey TEXT NOT NULL, -- key that started the import
+									status TEXT NOT NULL DEFAULT 'queued', -- queued, running, done or failed
+									processed INTEGER NOT NULL DEFAULT 0, -- entries read so far
+									total INTEGER NOT NULL DEFAULT 0, -- entries in the upload, counted once the job starts running
+									report TEXT NOT NULL DEFAULT '', -- restock report as json once the job is done, or failed partway
+									error TEXT NOT NULL DEFAULT '', -- why the job failed
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now')), -- when the job was created in unix seconds
+									finished INTEGER NOT NULL DEFAULT 0); -- when the job finished in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateFingerprintTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS fingerprints(
+									fingerprint TEXT NOT NULL PRIMARY KEY UNIQUE, -- sha256 of the lowercase email of an imported alt
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))); -- when the alt was first imported in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateBatchTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS batches(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the import batch
+									apikey TEXT NOT NULL, -- key that restocked the batch
+									source TEXT NOT NULL DEFAULT '', -- file name the batch was imported from
+									format TEXT NOT NULL DEFAULT '', -- format the batch was read as
+									pool TEXT NOT NULL, -- pool the batch was restocked into
+									status TEXT NOT NULL DEFAULT 'importing', -- importing, done, failed or rolledback
+									total INTEGER NOT NULL DEFAULT 0, -- lines read
+									added INTEGER NOT NULL DEFAULT 0, -- alts added to stock
+									rejected INTEGER NOT NULL DEFAULT 0, -- lines that were duplicate, malformed, invalid or failed
+									error TEXT NOT NULL DEFAULT '', -- why the import failed
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now')), -- when the import started in unix seconds
+									rolledback INTEGER NOT NULL DEFAULT 0, -- when the batch was rolled back in unix seconds
+									removed INTEGER NOT NULL DEFAULT 0); -- alts removed from stock by the rollback`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateDataKeyTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS datakeys(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the data key, stored with every password it encrypted
+									wrapped TEXT NOT NULL, -- data key encrypted with the master key
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))); -- when the data key was created in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateWebhookTables() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS webhooks(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the webhook
+									url TEXT NOT NULL, -- url events are posted to
+									events TEXT NOT NULL, -- comma separated events the webhook is subscribed to, * for every event
+									secret TEXT NOT NULL, -- secret deliveries are signed with
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))); -- when the webhook was created in unix seconds`,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = database.Exec(`CREATE TABLE IF NOT EXISTS deliveries(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the delivery
+									webhook INTEGER NOT NULL, -- webhook the event is delivered to
+									event TEXT NOT NULL, -- type of the event
+									payload TEXT NOT NULL, -- json body that is posted
+									status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered or failed
+									attempts INTEGER NOT NULL DEFAULT 0, -- times the delivery was tried
+									nextattempt INTEGER NOT NULL DEFAULT 0, -- when the delivery is tried again in unix seconds
+									responsecode INTEGER NOT NULL DEFAULT 0, -- status code of the last attempt, 0 if there was no response
+									error TEXT NOT NULL DEFAULT '', -- why the last attempt failed
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now')), -- when the event was queued in unix seconds
+									delivered INTEGER NOT NULL DEFAULT 0); -- when the delivery succeeded in unix seconds`,
+	)
+	return err
+}
+
+func (databaseConnection *DatabaseConnection) CreateAuditTable() error {
+	database := databaseConnection.Database
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS audit(
+									id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE, -- id of the audit entry
+									apikey TEXT NOT NULL, -- key that made the change
+									action TEXT NOT NULL, -- what was done, delete or purge
+									target TEXT NOT NULL DEFAULT '', -- what it was done to, like the id, email, pool or batch
+									count INTEGER NOT NULL DEFAULT 0, -- how many alts were affected
+									created INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))); -- when the change was made in unix seconds`,
+	)
+	return err
+}
+
+// indexes are created after the column migrations since they can be on migrated columns
+var indexes = []string{
+	"CREATE INDEX IF NOT EXISTS altlist_batch ON altlist(batch)",                       // counting and rolling back batches
+	"CREATE INDEX IF NOT EXISTS dispenses_batch ON dispenses(batch)",                   // counting dispensed alts of a batch
+	"CREATE INDEX IF NOT EXISTS dispenses_dispensed ON dispenses(dispensed)",           // dispense statistics over recent time
+	"CREATE INDEX IF NOT EXISTS deliveries_pending ON deliveries(status, nextattempt)", // finding deliveries that are due
+	"CREATE INDEX IF NOT EXISTS deliveries_webhook ON deliveries(webhook)",             // listing and deleting deliveries of a webhook
+}
+
+/*
+CreateIndexes ~ Used to create the indexes that keep counting and filtering from scanning whole tables
+*/
+func (databaseConnection *DatabaseConnection) CreateIndexes() error {
+	for _, index := range indexes {
+		_, err := databaseConnection.Database.Exec(index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+columnMigration ~ a column that was added to an existing table after it was first created
+*/
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+var columnMigrations = []columnMigration{
+	{"apikeys", "maxbatch", "INTEGER NOT NULL DEFAULT 0"},       // max items per generate call, 0 uses the server default
+	{"apikeys", "quota", "INTEGER NOT NULL DEFAULT 0"},          // max items the key may ever generate, 0 is unlimited
+	{"apikeys", "replacelimit", "INTEGER NOT NULL DEFAULT 0"},   // max replacements the key may receive per day, 0 uses the server default
+	{"apikeys", "cooldownuntil", "INTEGER NOT NULL DEFAULT 0"},  // unix seconds until the key may generate again
+	{"altlist", "leaseid", "TEXT NOT NULL DEFAULT ''"},          // lease or removing export the alt is reserved under, empty when in stock
+	{"altlist", "pool", "TEXT NOT NULL DEFAULT 'default'"},      // inventory pool the alt belongs to
+	{"dispenses", "pool", "TEXT NOT NULL DEFAULT 'default'"},    // inventory pool the alt was dispensed from
+	{"apikeys", "pools", "TEXT NOT NULL DEFAULT ''"},            // comma separated pools the key may generate from, empty for all
+	{"altlist", "priority", "INTEGER NOT NULL DEFAULT 0"},       // higher priority alts are dispensed first by the priority strategy
+	{"pools", "emailcheck", "INTEGER NOT NULL DEFAULT 0"},       // if imported emails have to be valid email addresses
+	{"pools", "minlength", "INTEGER NOT NULL DEFAULT 1"},        // shortest email or password allowed on import
+	{"pools", "maxlength", "INTEGER NOT NULL DEFAULT 256"},      // longest email or password allowed on import
+	{"pools", "charset", "TEXT NOT NULL DEFAULT 'printable'"},   // characters allowed on import, any, printable or ascii
+	{"pools", "pattern", "TEXT NOT NULL DEFAULT ''"},            // regex each imported email:password has to match
+	{"altlist", "batch", "INTEGER NOT NULL DEFAULT 0"},          // import batch the alt came from, 0 if imported before batches
+	{"dispenses", "batch", "INTEGER NOT NULL DEFAULT 0"},        // import batch the dispensed alt came from
+	{"pools", "lowstock", "INTEGER NOT NULL DEFAULT 0"},         // stock below which the alert webhook is called, 0 disables alerts
+	{"pools", "alerturl", "TEXT NOT NULL DEFAULT ''"},           // webhook low-stock alerts are sent to
+	{"pools", "alertformat", "TEXT NOT NULL DEFAULT 'generic'"}, // payload format of the alerts, generic or discord
+}
+
+/*
+MigrateColumns ~ Used to add any missing columns from columnMigrations to their tables
+*/
+func (databaseConnection *DatabaseConnection) MigrateColumns() error {
+	for _, migration := range columnMigrations {
+		exists, err := databaseConnection.hasColumn(migration.table, migration.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = databaseConnection.Database.Exec("ALTER TABLE " + migration.table + " ADD COLUMN " + migration.column + " " + migration.definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (databaseConnection *DatabaseConnection) hasColumn(table string, column string) (bool, error) {
+	result, err := databaseConnection.Database.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	for result.Next() {
+		var name string
+		err = result.Scan(&name)
+		if err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, result.Err()
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// spoolChunk is how much of an upload is sealed at a time when it is spooled to disk
+const spoolChunk = 64 * 1024
+
+/*
+spoolFile ~ Used to write an upload to disk encrypted with a random key that only lives in memory, so alts waiting for an
+import job aren't left on disk in plaintext. The file can't be read back after a restart, which is fine since
+interrupted jobs are failed on startup anyway. Returns the key to read the file back with
+*/
+func spoolFile(writer io.Writer, source io.Reader) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := make([]byte, spoolChunk)
+	for {
+		read, err := io.ReadFull(source, chunk)
+		if read > 0 {
+			nonce := make([]byte, aead.NonceSize())
+			_, nonceError := rand.Read(nonce)
+			if nonceError != nil {
+				return nil, nonceError
+			}
+			sealed := aead.Seal(nonce, nonce, chunk[:read], nil)
+			length := make([]byte, 4)
+			binary.BigEndian.PutUint32(length, uint32(len(sealed)))
+			_, writeError := writer.Write(append(length, sealed...))
+			if writeError != nil {
+				return nil, writeError
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return key, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+spoolReader ~ Reads back a file written by spoolFile
+*/
+type spoolReader struct {
+	source  io.Reader
+	aead    cipher.AEAD
+	pending []byte
+}
+
+func newSpoolReader(source io.Reader, key []byte) (*spoolReader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &spoolReader{source: source, aead: aead}, nil
+}
+
+func (reader *spoolReader) Read(buffer []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		length := make([]byte, 4)
+		_, err := io.ReadFull(reader.source, length)
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		sealed := make([]byte, binary.BigEndian.Uint32(length))
+		_, err = io.ReadFull(reader.source, sealed)
+		if err != nil {
+			return 0, err
+		}
+		if len(sealed) < reader.aead.NonceSize() {
+			return 0, errors.New("spooled upload is corrupted")
+		}
+		nonce, ciphertext := sealed[:reader.aead.NonceSize()], sealed[reader.aead.NonceSize():]
+		reader.pending, err = reader.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return 0, errors.New("spooled upload is corrupted")
+		}
+	}
+	read := copy(buffer, reader.pending)
+	reader.pending = reader.pending[read:]
+	return read, nil
+}
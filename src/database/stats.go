@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+)
+
+/*
+GetDispensedPerPool ~ Used to get how many alts each pool dispensed since the unix time
+*/
+func (database *DatabaseConnection) GetDispensedPerPool(since int64) (map[string]int, error) {
+	result, err := database.Database.Query("SELECT pool, COUNT(*) FROM dispenses WHERE dispensed >= ? GROUP BY pool", since)
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	pools := map[string]int{}
+	for result.Next() {
+		var pool string
+		var dispensed int
+		err = result.Scan(&pool, &dispensed)
+		if err != nil {
+			return nil, err
+		}
+		pools[pool] = dispensed
+	}
+	return pools, result.Err()
+}
+
+/*
+CountActiveKeys ~ Used to count the keys that were dispensed alts since the unix time
+*/
+func (database *DatabaseConnection) CountActiveKeys(since int64) (int, error) {
+	var active int
+	err := database.Database.QueryRow("SELECT COUNT(DISTINCT apikey) FROM dispenses WHERE dispensed >= ?", since).Scan(&active)
+	return active, err
+}
+
+/*
+CountKeys ~ Used to count the keys that aren't disabled
+*/
+func (database *DatabaseConnection) CountKeys() (int, error) {
+	var keys int
+	err := database.Database.QueryRow("SELECT COUNT(*) FROM apikeys WHERE disabled = 0").Scan(&keys)
+	return keys, err
+}
@@ -1,91 +1,701 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"io"
 	"log"
 	"strconv"
-	"strings"
 	"time"
 )
 
+var ErrNotEnoughStock = errors.New("not enough stock")
+
+/*
+LimitError ~ Returned when the cooldown or quota of a key doesn't allow it to dispense
+*/
+type LimitError struct {
+	// Limit is either "cooldown" or "quota"
+	Limit string
+	// Left is the seconds left of the cooldown, or the alts left in the quota
+	Left int
+}
+
+func (err *LimitError) Error() string {
+	if err.Limit == "cooldown" {
+		return "cooldown not over (" + strconv.Itoa(err.Left) + "s)"
+	}
+	return "quota exceeded (" + strconv.Itoa(err.Left) + " remaining)"
+}
+
 func (database *DatabaseConnection) GetStockAmount() (int, error) {
 	// get stock amount
 	var stock int
-	err := database.Database.QueryRow("SELECT COUNT(*) FROM altlist").Scan(&stock)
+	err := database.Database.QueryRow("SELECT COUNT(*) FROM altlist WHERE leaseid = ''").Scan(&stock)
 	if err != nil {
 		return 0, err
 	}
 	return stock, nil
 }
 
-func (database *DatabaseConnection) GetAltAndRemoveFromStock() (*Alt, error) {
-	// get stock amount
-	var alt Alt
-	err := database.Database.QueryRow("SELECT * FROM altlist LIMIT 1").Scan(&alt.Id, &alt.Email, &alt.Password)
+/*
+GetPoolStockAmount ~ Used to get the amount of alts in stock in a single pool
+*/
+func (database *DatabaseConnection) GetPoolStockAmount(pool string) (int, error) {
+	var stock int
+	err := database.Database.QueryRow("SELECT COUNT(*) FROM altlist WHERE leaseid = '' AND pool = ?", pool).Scan(&stock)
+	if err != nil {
+		return 0, err
+	}
+	return stock, nil
+}
+
+/*
+GetStockPerPool ~ Used to get the amount of alts in stock for every pool that has stock
+*/
+func (database *DatabaseConnection) GetStockPerPool() (map[string]int, error) {
+	result, err := database.Database.Query("SELECT pool, COUNT(*) FROM altlist WHERE leaseid = '' GROUP BY pool")
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	pools := map[string]int{}
+	for result.Next() {
+		var pool string
+		var stock int
+		err = result.Scan(&pool, &stock)
+		if err != nil {
+			return nil, err
+		}
+		pools[pool] = stock
+	}
+	return pools, result.Err()
+}
+
+/*
+DispenseAlts ~ Used to remove up to count alts from a pool for a key, consuming its cooldown and quota for each alt.
+If allOrNothing is set and there are fewer than count alts in stock, nothing is removed and ErrNotEnoughStock is returned.
+A *LimitError is returned when the cooldown isn't over or the quota can't cover the alts, unless allOrNothing isn't set
+and some quota is left, then only that many alts are dispensed.
+The dispense is counted and announced by DeliveredAlts once the alts reached the client, or taken back by UndoDispense.
+*/
+func (database *DatabaseConnection) DispenseAlts(key string, pool string, count int, allOrNothing bool) ([]Alt, error) {
+	return database.dispenseAlts(key, pool, count, allOrNothing, "", 0)
+}
+
+/*
+LeaseAlts ~ Same as DispenseAlts, but the alts are only reserved under a new lease until it is confirmed or expires
+*/
+func (database *DatabaseConnection) LeaseAlts(key string, pool string, count int, allOrNothing bool, timeout time.Duration) (string, int64, []Alt, error) {
+	leaseId, err := randomId()
+	if err != nil {
+		return "", 0, nil, err
+	}
+	expires := time.Now().Add(timeout).Unix()
+	alts, err := database.dispenseAlts(key, pool, count, allOrNothing, leaseId, expires)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return leaseId, expires, alts, nil
+}
+
+/*
+beginDispense ~ Used to get the dispense order of a pool and begin the transaction that takes alts from it.
+The strategy is read before the transaction so its first statement is a write, a transaction that reads
+first can't wait for the write lock and fails with "database is locked" when another dispense holds it
+*/
+func (database *DatabaseConnection) beginDispense(pool string) (string, *sql.Tx, error) {
+	order, err := poolOrder(database.Database, pool)
+	if err != nil {
+		return "", nil, err
+	}
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	return order, tx, nil
+}
+
+func (database *DatabaseConnection) dispenseAlts(key string, pool string, count int, allOrNothing bool, leaseId string, leaseExpires int64) ([]Alt, error) {
+	order, tx, err := database.beginDispense(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// either remove the alts outright or reserve them under the lease
+	var result *sql.Rows
+	if leaseId == "" {
+		result, err = tx.Query("DELETE FROM altlist WHERE id IN (SELECT id FROM altlist WHERE leaseid = '' AND pool = ? ORDER BY "+order+" LIMIT ?) RETURNING "+altColumns, pool, count)
+	} else {
+		_, err = tx.Exec("INSERT INTO leases (id, apikey, expires) VALUES (?, ?, ?)", leaseId, key, leaseExpires)
+		if err != nil {
+			return nil, err
+		}
+		result, err = tx.Query("UPDATE altlist SET leaseid = ? WHERE id IN (SELECT id FROM altlist WHERE leaseid = '' AND pool = ? ORDER BY "+order+" LIMIT ?) RETURNING "+altColumns, leaseId, pool, count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	alts, err := scanAlts(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(alts) == 0 || (allOrNothing && len(alts) < count) {
+		return nil, ErrNotEnoughStock
+	}
+
+	// leased alts are only recorded as dispensed once the lease is confirmed
+	if leaseId == "" {
+		err = recordDispenses(tx, key, alts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// consume the cooldown and quota proportionally to the amount of alts dispensed, checking them in the same statement
+	// so concurrent requests of a key can't both get past the checks the handler made before
+	now := time.Now().Unix()
+	updated, err := tx.Exec(`UPDATE apikeys SET lastgenerated = ?, cooldownuntil = ?, uses = uses + ?
+							WHERE apikey = ? AND MAX(cooldownuntil, lastgenerated + ?) <= ? AND (quota = 0 OR uses + ? <= quota)`,
+		now, now+GenerateCooldown*int64(len(alts)), len(alts), key, GenerateCooldown, now, len(alts))
+	if err != nil {
+		return nil, err
+	}
+	affected, err := updated.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		limit, err := keyLimit(tx, key, now)
+		if err != nil {
+			return nil, err
+		}
+		// best effort dispenses what is left of the quota instead
+		if limit.Limit == "quota" && !allOrNothing && limit.Left > 0 {
+			_ = tx.Rollback()
+			return database.dispenseAlts(key, pool, limit.Left, false, leaseId, leaseExpires)
+		}
+		return nil, limit
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	markStockChanged()
+	return alts, nil
+}
+
+/*
+DeliveredAlts ~ Used once dispensed alts reached the client to count them and announce the dispense,
+alts that never reached it are put back with UndoDispense instead so they are never counted.
+Leased alts are counted by ConfirmLease once they are confirmed instead
+*/
+func (database *DatabaseConnection) DeliveredAlts(key string, alts []Alt) {
+	countDispensed(alts, "generate")
+	database.publishEvent(EventItemDispensed, database.dispenseEvent(key, "generate", alts))
+}
+
+/*
+keyLimit ~ Used to find out which limit kept a key from dispensing, inside the dispense transaction so it sees what the update saw
+*/
+func keyLimit(tx *sql.Tx, key string, now int64) (*LimitError, error) {
+	var nextGenerate int64
+	var quota, uses int
+	err := tx.QueryRow("SELECT MAX(cooldownuntil, lastgenerated + ?), quota, uses FROM apikeys WHERE apikey = ?", GenerateCooldown, key).
+		Scan(&nextGenerate, &quota, &uses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if nextGenerate > now {
+		return &LimitError{Limit: "cooldown", Left: int(nextGenerate - now)}, nil
+	}
+	remaining := quota - uses
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &LimitError{Limit: "quota", Left: remaining}, nil
+}
+
+/*
+recordDispenses ~ Used to keep a record of alts given to a key, setting the dispense id of each alt
+*/
+func recordDispenses(tx *sql.Tx, key string, alts []Alt) error {
+	for i := range alts {
+		password, err := encryptPassword(alts[i].Password)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow("INSERT INTO dispenses (apikey, email, password, pool, batch) VALUES (?, ?, ?, ?, ?) RETURNING id",
+			key, alts[i].Email, password, alts[i].Pool, alts[i].Batch).Scan(&alts[i].DispenseId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// altColumns are the columns of altlist read by scanAlts
+const altColumns = "id, email, password, pool, priority, batch"
+
+/*
+scanAlts ~ Used to read altColumns rows into alts and close the result
+*/
+func scanAlts(result *sql.Rows) ([]Alt, error) {
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	var alts []Alt
+	for result.Next() {
+		var alt Alt
+		err := result.Scan(&alt.Id, &alt.Email, &alt.Password, &alt.Pool, &alt.Priority, &alt.Batch)
+		if err != nil {
+			return nil, err
+		}
+		alt.Password, err = decryptPassword(alt.Password)
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, alt)
+	}
+	return alts, result.Err()
+}
+
+/*
+UndoDispense ~ Used to take back a dispense that never reached the client. The alts go back into stock under their original id,
+keeping their place in the dispense order, their dispense records are removed and the quota they used is given back.
+The cooldown stays since the key did make the request
+*/
+func (database *DatabaseConnection) UndoDispense(key string, alts []Alt) error {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	_, err = tx.Exec("UPDATE apikeys SET uses = MAX(uses - ?, 0) WHERE apikey = ?", len(alts), key)
+	if err != nil {
+		return err
+	}
+	for _, alt := range alts {
+		_, err = tx.Exec("DELETE FROM dispenses WHERE id = ?", alt.DispenseId)
+		if err != nil {
+			return err
+		}
+		password, err := encryptPassword(alt.Password)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO altlist (id, email, password, pool, priority, batch) VALUES (?, ?, ?, ?, ?, ?)",
+			alt.Id, alt.Email, password, alt.Pool, alt.Priority, alt.Batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	markStockChanged()
+	return nil
+}
+
+/*
+ImportOptions ~ Settings for how alts from an import are added to stock
+*/
+type ImportOptions struct {
+	Pool     string
+	Priority int
+	// Key is who restocked the import, recorded on its batch
+	Key string
+	// Source is the file the import was read from, recorded on its batch
+	Source string
+	// Format is the ImportFormats entry the import is read as, empty reads email:password lines
+	Format string
+	// BatchSize is how many lines are inserted per transaction, 0 uses DefaultImportBatchSize
+	BatchSize int
+	// Atomic imports the whole file in one transaction, so nothing is added if any line fails
+	Atomic bool
+	// Details lists the line number and reason of each rejected line in the report, up to MaxRejectedLines
+	Details bool
+	// DryRun reads and checks the whole import against stock and import history without adding anything
+	DryRun bool
+	// AllowRestock adds alts again that were imported or dispensed before, as long as they aren't in stock
+	AllowRestock bool
+	// Progress is called with the amount of entries read so far, every time another batch worth was read
+	Progress func(processed int)
+}
+
+// MaxRejectedLines is how many rejected lines a detailed restock report lists at most
+var MaxRejectedLines = 100
+
+// DefaultImportBatchSize is how many lines are inserted per transaction when the import doesn't set one
+var DefaultImportBatchSize = 1000
+
+// MaxLineLength is the longest line an import will read before giving up on the file
+const MaxLineLength = 1 << 20
+
+/*
+importTarget ~ Where the alts of an import end up, add returns why an alt was rejected or an empty string if it was added
+*/
+type importTarget interface {
+	add(email string, password string, pool string, priority int) (string, error)
+	commit() error
+	rollback()
+}
+
+/*
+importBatch ~ A transaction with prepared inserts that alts are added to until it is committed
+*/
+type importBatch struct {
+	tx           *sql.Tx
+	insert       *sql.Stmt
+	fingerprint  *sql.Stmt
+	batchId      int64
+	allowRestock bool
+	size         int
+}
+
+func (database *DatabaseConnection) beginImportBatch(batchId int64, allowRestock bool) (*importBatch, error) {
+	tx, err := database.Database.Begin()
 	if err != nil {
 		return nil, err
 	}
-	_, err = database.Database.Exec("DELETE FROM altlist WHERE id = ?", alt.Id)
+	insert, err := tx.Prepare("INSERT OR IGNORE INTO altlist (email, password, pool, priority, batch) VALUES (?, ?, ?, ?, ?)")
 	if err != nil {
+		_ = tx.Rollback()
 		return nil, err
 	}
-	return &alt, nil
+	fingerprint, err := tx.Prepare("INSERT OR IGNORE INTO fingerprints (fingerprint) VALUES (?)")
+	if err != nil {
+		_ = insert.Close()
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return &importBatch{tx: tx, insert: insert, fingerprint: fingerprint, batchId: batchId, allowRestock: allowRestock}, nil
 }
 
-func (database *DatabaseConnection) AddAltToStock(email string, password string) error {
-	_, err := database.Database.Exec("INSERT INTO altlist (email, password) VALUES (?, ?)", email, password)
-	return err
+/*
+add ~ Used to insert an alt in the batch unless it is in stock or was imported before
+*/
+func (batch *importBatch) add(email string, password string, pool string, priority int) (string, error) {
+	batch.size++
+
+	// alts that were ever imported before are only added again when the import allows restocking them
+	result, err := batch.fingerprint.Exec(Fingerprint(email))
+	if err != nil {
+		return "", err
+	}
+	newFingerprint, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if newFingerprint == 0 && !batch.allowRestock {
+		inStock, err := exists(batch.tx, "SELECT 1 FROM altlist WHERE email = ?", email)
+		if err != nil {
+			return "", err
+		}
+		if inStock {
+			return "duplicate", nil
+		}
+		return "previously imported", nil
+	}
+
+	password, err = encryptPassword(password)
+	if err != nil {
+		return "", err
+	}
+	result, err = batch.insert.Exec(email, password, pool, priority, batch.batchId)
+	if err != nil {
+		return "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "duplicate", nil
+	}
+	return "", nil
+}
+
+func (batch *importBatch) commit() error {
+	_ = batch.insert.Close()
+	_ = batch.fingerprint.Close()
+	return batch.tx.Commit()
+}
+
+func (batch *importBatch) rollback() {
+	_ = batch.insert.Close()
+	_ = batch.fingerprint.Close()
+	_ = batch.tx.Rollback()
 }
 
-func (database *DatabaseConnection) AddAccountsFromFile(file io.Reader, fileSize int64) (string, error) {
-	fileBuffer := make([]byte, fileSize)
-	_, err := file.Read(fileBuffer)
+/*
+dryRunCheck ~ Checks alts against stock, import history and the rest of the import without adding them
+*/
+type dryRunCheck struct {
+	database     *DatabaseConnection
+	report       *RestockReport
+	allowRestock bool
+	seen         map[string]struct{}
+}
+
+func (check *dryRunCheck) add(email string, _ string, _ string, _ int) (string, error) {
+	fingerprint := Fingerprint(email)
+	if _, ok := check.seen[fingerprint]; ok {
+		return "duplicate", nil
+	}
+	inStock, err := exists(check.database.Database, "SELECT 1 FROM altlist WHERE email = ?", email)
+	if err != nil {
+		return "", err
+	}
+	if inStock {
+		return "duplicate", nil
+	}
+	imported, err := exists(check.database.Database, "SELECT 1 FROM fingerprints WHERE fingerprint = ?", fingerprint)
 	if err != nil {
 		return "", err
 	}
-	fileData := string(fileBuffer)
-	combos := strings.Split(fileData, "\n")
-	total := 0
-	success := 0
-	for _, combo := range combos {
-		combo = strings.ReplaceAll(combo, "\n", "")
-		combo = strings.ReplaceAll(combo, "\r", "")
-		combo = strings.ReplaceAll(combo, " ", "")
-		alt := strings.Split(combo, ":")
-		if len(alt) != 2 {
+	if imported && !check.allowRestock {
+		return "previously imported", nil
+	}
+	check.seen[fingerprint] = struct{}{}
+
+	// alts that were dispensed before are counted so restocking them again can be looked at
+	dispensed, err := exists(check.database.Database, "SELECT 1 FROM dispenses WHERE email = ?", email)
+	if err != nil {
+		return "", err
+	}
+	if dispensed {
+		check.report.PreviouslyDispensed++
+	}
+	return "", nil
+}
+
+func (check *dryRunCheck) commit() error {
+	return nil
+}
+
+func (check *dryRunCheck) rollback() {}
+
+func exists(database queryRower, query string, args ...any) (bool, error) {
+	var found int
+	err := database.QueryRow(query, args...).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+/*
+reject ~ Used to count a rejected line in the report, listing it if the import asked for details
+*/
+func (report *RestockReport) reject(options ImportOptions, line int, reason string) {
+	if !options.Details {
+		return
+	}
+	if len(report.Rejected) >= MaxRejectedLines {
+		report.Truncated = true
+		return
+	}
+	report.Rejected = append(report.Rejected, RejectedLine{Line: line, Reason: reason})
+}
+
+/*
+AddAccountsFromFile ~ Used to add every alt of an import to stock, reading it one item at a time so
+the whole file never has to be held in memory and inserting it in batched transactions.
+Every import that isn't a dry run is recorded as a batch its alts are linked to, so it can be rolled back later
+*/
+func (database *DatabaseConnection) AddAccountsFromFile(file io.Reader, options ImportOptions) (*RestockReport, error) {
+	if options.DryRun {
+		return database.importItems(file, options, 0)
+	}
+
+	batchId, err := database.createBatch(options)
+	if err != nil {
+		return nil, err
+	}
+	report, err := database.importItems(file, options, batchId)
+	database.finishBatch(batchId, report, err)
+	if report != nil {
+		report.Batch = batchId
+		countRestock(report)
+	}
+	// imports that failed may still have added alts
+	markStockChanged()
+	if err == nil {
+		database.publishEvent(EventRestockCompleted, RestockEvent{
+			Owner:    database.ownerOf(options.Key),
+			Batch:    batchId,
+			Pool:     options.Pool,
+			Source:   options.Source,
+			Total:    report.Total,
+			Added:    report.Added,
+			Rejected: report.Total - report.Added,
+		})
+	}
+	return report, err
+}
+
+/*
+importItems ~ Used to read an import and add its items to stock under the batch.
+When the import fails partway the report of what was read is returned with the error, counting only the alts that stayed in stock
+*/
+func (database *DatabaseConnection) importItems(file io.Reader, options ImportOptions, batchId int64) (*RestockReport, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+
+	items, err := NewItemReader(options.Format, file)
+	if err != nil {
+		return nil, err
+	}
+
+	validators, err := database.loadValidators()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RestockReport{DryRun: options.DryRun}
+	var batch importTarget
+	if options.DryRun {
+		batch = &dryRunCheck{database: database, report: report, allowRestock: options.AllowRestock, seen: map[string]struct{}{}}
+	} else {
+		batch, err = database.beginImportBatch(batchId, options.AllowRestock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// committed is how many alts were added by the batches committed so far, when the import fails only those stay in stock
+	committed := 0
+	failed := func(err error) (*RestockReport, error) {
+		batch.rollback()
+		if !options.DryRun {
+			report.Added = committed
+		}
+		return report, err
+	}
+
+	reported := 0
+	for {
+		// progress is reported at the top so skipped entries move it too
+		if options.Progress != nil && report.Total-reported >= batchSize {
+			reported = report.Total
+			options.Progress(reported)
+		}
+		item, err := items.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var malformed *MalformedError
+		if errors.As(err, &malformed) {
+			report.Total++
+			report.Malformed++
+			report.reject(options, malformed.Line, malformed.Reason)
 			continue
 		}
-		err = database.AddAltToStock(alt[0], alt[1])
-		total++
 		if err != nil {
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-				log.Println(" [!] Duplicate account:", alt[0], alt[1])
+			return failed(err)
+		}
+		report.Total++
+
+		pool := options.Pool
+		if item.Pool != "" {
+			pool = item.Pool
+			if !IsValidPoolName(pool) {
+				report.Malformed++
+				report.reject(options, item.Line, "invalid pool")
 				continue
 			}
-			return "", err
 		}
-		log.Println(" [+] Added alt: " + alt[0] + ":" + alt[1])
-		success++
+
+		// check the item against the validation rules of its pool
+		rules, ok := validators[pool]
+		if !ok {
+			rules, err = newValidator(defaultPool(pool))
+			if err != nil {
+				return failed(err)
+			}
+			validators[pool] = rules
+		}
+		if rule := rules.check(item); rule != "" {
+			if report.Invalid == nil {
+				report.Invalid = map[string]int{}
+			}
+			report.Invalid[rule]++
+			report.reject(options, item.Line, "invalid "+rule)
+			continue
+		}
+
+		rejected, err := batch.add(item.Email, item.Password, pool, options.Priority)
+		if err != nil {
+			// a failed line fails the whole import when it has to be atomic
+			if options.Atomic {
+				return failed(err)
+			}
+			report.Failed++
+			report.reject(options, item.Line, err.Error())
+			continue
+		}
+		if rejected != "" {
+			report.Duplicate++
+			report.reject(options, item.Line, rejected)
+			continue
+		}
+		report.Added++
+
+		// commit full batches unless the whole import has to succeed or fail together
+		if writer, ok := batch.(*importBatch); ok && !options.Atomic && writer.size >= batchSize {
+			err = batch.commit()
+			if err != nil {
+				return failed(err)
+			}
+			committed = report.Added
+			next, err := database.beginImportBatch(batchId, options.AllowRestock)
+			if err != nil {
+				return report, err
+			}
+			batch = next
+		}
+	}
+	err = batch.commit()
+	if err != nil {
+		return failed(err)
 	}
-	return "Added " + strconv.Itoa(success) + " accounts out of " + strconv.Itoa(total), nil
+
+	if !options.DryRun {
+		log.Println(" [+] Added", report.Added, "alts to pool", options.Pool, "out of", report.Total)
+	}
+	return report, nil
 }
 
 func (database *DatabaseConnection) GetCooldown(key string) (int, error) {
 	// returns time until cooldown is over
-	var cooldown int
-	err := database.Database.QueryRow("SELECT lastgenerated FROM apikeys WHERE apikey = ?", key).Scan(&cooldown)
+	var nextGen int
+	err := database.Database.QueryRow("SELECT MAX(cooldownuntil, lastgenerated + ?) FROM apikeys WHERE apikey = ?", GenerateCooldown, key).Scan(&nextGen)
 	if err != nil {
 		return 0, err
 	}
 
-	nextGen := cooldown + int(GenerateCooldown)
 	if nextGen < int(time.Now().Unix()) {
 		return 0, nil
 	}
 	return nextGen - int(time.Now().Unix()), nil
 }
-
-func (database *DatabaseConnection) SetCooldown(key string) error {
-	_, err := database.Database.Exec("UPDATE apikeys SET lastgenerated = ? WHERE apikey = ?", time.Now().Unix(), key)
-	return err
-}
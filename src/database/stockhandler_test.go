@@ -0,0 +1,304 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+/*
+testCombos ~ Used to build lines of changing length so they end up crossing the buffer boundaries of every reader on the way,
+passwords stay within the default max length of pools
+*/
+func testCombos(count int) []string {
+	combos := make([]string, count)
+	for i := range combos {
+		combos[i] = fmt.Sprintf("user%d@example.com:%s:%d", i, strings.Repeat("p", i%200), i)
+	}
+	return combos
+}
+
+func multipartBody(t *testing.T, content string) ([]byte, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("altfile", "alts.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.WriteString(file, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = form.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body.Bytes(), form.Boundary()
+}
+
+func readCombos(t *testing.T, items ItemReader) []string {
+	t.Helper()
+	var combos []string
+	for {
+		item, err := items.Read()
+		if errors.Is(err, io.EOF) {
+			return combos
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		combos = append(combos, item.Email+":"+item.Password)
+	}
+}
+
+func TestMultipartShortReads(t *testing.T) {
+	combos := testCombos(3000)
+	body, boundary := multipartBody(t, strings.Join(combos, "\r\n")+"\n")
+
+	shortReaders := map[string]func(io.Reader) io.Reader{
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+	for name, shortReader := range shortReaders {
+		t.Run(name, func(t *testing.T) {
+			form := multipart.NewReader(shortReader(bytes.NewReader(body)), boundary)
+			part, err := form.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			items, err := NewItemReader("colon", shortReader(part))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			read := readCombos(t, items)
+			if len(read) != len(combos) {
+				t.Fatalf("read %d items, want %d", len(read), len(combos))
+			}
+			for i := range combos {
+				if read[i] != combos[i] {
+					t.Fatalf("item %d is %q, want %q", i, read[i], combos[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImportShortReads(t *testing.T) {
+	database := newTestDatabase(t)
+	combos := testCombos(2000)
+
+	report, err := database.AddAccountsFromFile(iotest.HalfReader(strings.NewReader(strings.Join(combos, "\n"))), ImportOptions{Pool: "default", BatchSize: 97})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != len(combos) || report.Added != len(combos) {
+		t.Fatalf("report has %d total and %d added, want %d", report.Total, report.Added, len(combos))
+	}
+	stock, err := database.GetPoolStockAmount("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != len(combos) {
+		t.Fatalf("stock is %d, want %d", stock, len(combos))
+	}
+}
+
+func BenchmarkImport100k(b *testing.B) {
+	database := newTestDatabase(b)
+	const lines = 100000
+	var importing time.Duration
+
+	for i := 0; i < b.N; i++ {
+		// every run imports new alts, otherwise they would all be duplicates of the first run
+		b.StopTimer()
+		var content strings.Builder
+		for line := 0; line < lines; line++ {
+			_, _ = fmt.Fprintf(&content, "bench%d-%d@example.com:password%d\n", i, line, line)
+		}
+		options := ImportOptions{Pool: "default", BatchSize: DefaultImportBatchSize}
+		batchId, err := database.createBatch(options)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		start := time.Now()
+		report, err := database.importItems(strings.NewReader(content.String()), options, batchId)
+		importing += time.Since(start)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if report.Added != lines {
+			b.Fatalf("added %d alts, want %d", report.Added, lines)
+		}
+	}
+	b.ReportMetric(float64(lines*b.N)/importing.Seconds(), "lines/s")
+}
+
+func TestImportFailureKeepsPartialReport(t *testing.T) {
+	database := newTestDatabase(t)
+	var items []string
+	for i := 0; i < 5; i++ {
+		items = append(items, fmt.Sprintf(`{"email":"user%d@example.com","password":"p"}`, i))
+	}
+	// the broken item fails the import after two full batches were committed
+	input := "[" + strings.Join(items, ",") + `,{"email":broken}]`
+
+	report, err := database.AddAccountsFromFile(strings.NewReader(input), ImportOptions{Pool: "default", Format: "json", BatchSize: 2})
+	var formatError *FormatError
+	if !errors.As(err, &formatError) {
+		t.Fatalf("got error %v, want a FormatError", err)
+	}
+	if report == nil {
+		t.Fatal("no report returned with the error")
+	}
+	if report.Added != 4 || report.Total != 5 || report.Batch == 0 {
+		t.Fatalf("report has %d added, %d total and batch %d, want 4 added, 5 total and a batch", report.Added, report.Total, report.Batch)
+	}
+	stock, err := database.GetPoolStockAmount("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != report.Added {
+		t.Fatalf("stock is %d, the report says %d were added", stock, report.Added)
+	}
+
+	// nothing stays in stock when the import is atomic
+	report, err = database.AddAccountsFromFile(strings.NewReader(strings.ReplaceAll(input, "user", "atomic")), ImportOptions{Pool: "atomic", Format: "json", BatchSize: 2, Atomic: true})
+	if err == nil || report == nil || report.Added != 0 {
+		t.Fatalf("atomic import returned %+v and %v, want a report with nothing added and an error", report, err)
+	}
+}
+
+func TestDispenseQuotaRace(t *testing.T) {
+	database := newTestDatabase(t)
+	testKey(t, database, "quota", 5)
+	restockTest(t, database, "quota", "race", 50)
+
+	// every request passes the handler's quota check before any of them dispensed, only the quota may be dispensed
+	var dispensed, limited atomic.Int32
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			alts, err := database.DispenseAlts("quota", "quota", 1, true)
+			var limit *LimitError
+			switch {
+			case errors.As(err, &limit) && limit.Limit == "quota":
+				limited.Add(1)
+			case err != nil:
+				t.Error(err)
+			default:
+				dispensed.Add(int32(len(alts)))
+			}
+		}()
+	}
+	wait.Wait()
+	if dispensed.Load() != 5 || limited.Load() != 15 {
+		t.Fatalf("dispensed %d and limited %d requests, want 5 and 15", dispensed.Load(), limited.Load())
+	}
+
+	// best effort only dispenses what is left of the quota
+	testKey(t, database, "besteffort", 3)
+	alts, err := database.DispenseAlts("besteffort", "quota", 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alts) != 3 {
+		t.Fatalf("dispensed %d alts, want 3", len(alts))
+	}
+	_, err = database.DispenseAlts("besteffort", "quota", 1, false)
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Left != 0 {
+		t.Fatalf("got %v, want quota exceeded with nothing remaining", err)
+	}
+	stock, err := database.GetPoolStockAmount("quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 42 {
+		t.Fatalf("%d alts left in stock, want 42", stock)
+	}
+}
+
+func TestDispenseCooldown(t *testing.T) {
+	database := newTestDatabase(t)
+	GenerateCooldown = 60
+	t.Cleanup(func() {
+		GenerateCooldown = 0
+	})
+	testKey(t, database, "cooldown", 0)
+	restockTest(t, database, "cooldown", "cooldown", 5)
+
+	_, err := database.DispenseAlts("cooldown", "cooldown", 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cooldown is checked by the dispense itself, not only by the handler
+	_, err = database.DispenseAlts("cooldown", "cooldown", 1, true)
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Limit != "cooldown" || limit.Left <= 0 || limit.Left > 60 {
+		t.Fatalf("got %v, want the cooldown with up to 60s left", err)
+	}
+	stock, err := database.GetPoolStockAmount("cooldown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 4 {
+		t.Fatalf("%d alts left in stock, want 4", stock)
+	}
+}
+
+func TestUndoDispense(t *testing.T) {
+	database := newTestDatabase(t)
+	testKey(t, database, "undo", 3)
+	restockTest(t, database, "undo", "undo", 5)
+
+	alts, err := database.DispenseAlts("undo", "undo", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.UndoDispense("undo", alts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stock, err := database.GetPoolStockAmount("undo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, uses, err := database.GetKeyLimits("undo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dispenses int
+	err = database.Database.QueryRow("SELECT COUNT(*) FROM dispenses WHERE apikey = ?", "undo").Scan(&dispenses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 5 || uses != 0 || dispenses != 0 {
+		t.Fatalf("stock %d, uses %d and %d dispenses after the undo, want 5, 0 and 0", stock, uses, dispenses)
+	}
+
+	// the alts keep their place in the dispense order
+	again, err := database.DispenseAlts("undo", "undo", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range alts {
+		if again[i].Id != alts[i].Id {
+			t.Fatalf("dispensed alt %d after the undo, want %d", again[i].Id, alts[i].Id)
+		}
+	}
+}
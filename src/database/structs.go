@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 )
 
@@ -75,6 +76,97 @@ type ApiKey struct {
 	Disabled      bool
 	Owner         string `json:"owner,omitempty"`
 	Notes         string
+	MaxBatch      int
+	Quota         int
+	ReplaceLimit  int
+	CooldownUntil int64
+	Pools         string
+}
+
+type RestockReport struct {
+	// Batch is the import batch the alts were added under, 0 on dry runs
+	Batch     int64          `json:"batch,omitempty"`
+	DryRun    bool           `json:"dry_run,omitempty"`
+	Total     int            `json:"total"`
+	Added     int            `json:"added"`
+	Duplicate int            `json:"duplicate"`
+	Malformed int            `json:"malformed"`
+	Failed    int            `json:"failed"`
+	Rejected  []RejectedLine `json:"rejected,omitempty"`
+	// Truncated is set when more lines were rejected than are listed
+	Truncated bool `json:"truncated,omitempty"`
+	// PreviouslyDispensed counts added alts that were dispensed before, only checked on dry runs
+	PreviouslyDispensed int `json:"previously_dispensed,omitempty"`
+	// Invalid counts the lines rejected by each validation rule of the pool
+	Invalid map[string]int `json:"invalid,omitempty"`
+}
+
+type RejectedLine struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+type Job struct {
+	Id        string         `json:"id"`
+	Status    string         `json:"status"`
+	Processed int            `json:"processed"`
+	Total     int            `json:"total"`
+	Report    *RestockReport `json:"report,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Created   int64          `json:"created"`
+	Finished  int64          `json:"finished,omitempty"`
+}
+
+type Batch struct {
+	Id         int64  `json:"id"`
+	Owner      string `json:"owner"`
+	Source     string `json:"source,omitempty"`
+	Format     string `json:"format"`
+	Pool       string `json:"pool"`
+	Status     string `json:"status"`
+	Total      int    `json:"total"`
+	Added      int    `json:"added"`
+	Rejected   int    `json:"rejected"`
+	Error      string `json:"error,omitempty"`
+	Created    int64  `json:"created"`
+	RolledBack int64  `json:"rolled_back,omitempty"`
+	Removed    int    `json:"removed,omitempty"`
+	InStock    int    `json:"in_stock"`
+	Dispensed  int    `json:"dispensed"`
+}
+
+type AuditEntry struct {
+	Id      int64  `json:"id"`
+	Owner   string `json:"owner"`
+	Action  string `json:"action"`
+	Target  string `json:"target,omitempty"`
+	Count   int64  `json:"count"`
+	Created int64  `json:"created"`
+}
+
+type Webhook struct {
+	Id     int64    `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only set when the webhook is created
+	Secret  string `json:"secret,omitempty"`
+	Created int64  `json:"created"`
+	Pending int    `json:"pending"`
+	Failed  int    `json:"failed"`
+}
+
+type Delivery struct {
+	Id           int64           `json:"id"`
+	Webhook      int64           `json:"webhook"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	NextAttempt  int64           `json:"next_attempt,omitempty"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Created      int64           `json:"created"`
+	Delivered    int64           `json:"delivered,omitempty"`
 }
 
 type KeyCreator struct {
@@ -82,7 +174,47 @@ type KeyCreator struct {
 }
 
 type Alt struct {
-	Id       int
-	Email    string
-	Password string
+	Id         int
+	Email      string
+	Password   string
+	Pool       string
+	Priority   int
+	Batch      int64
+	DispenseId int
+}
+
+type Pool struct {
+	Name       string `json:"name"`
+	Strategy   string `json:"strategy"`
+	Stock      int    `json:"stock"`
+	EmailCheck bool   `json:"email_check"`
+	MinLength  int    `json:"min_length"`
+	MaxLength  int    `json:"max_length"`
+	Charset    string `json:"charset"`
+	Pattern    string `json:"pattern"`
+	// LowStock is the stock below which AlertURL is alerted, 0 disables alerts
+	LowStock    int    `json:"low_stock"`
+	AlertURL    string `json:"alert_url"`
+	AlertFormat string `json:"alert_format"`
+}
+
+type Dispense struct {
+	Id        int    `json:"id"`
+	ApiKey    string `json:"-"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Pool      string `json:"pool"`
+	Dispensed int64  `json:"dispensed"`
+}
+
+type Report struct {
+	Id          int    `json:"id"`
+	DispenseId  int    `json:"dispense_id"`
+	Owner       string `json:"owner"`
+	Email       string `json:"email"`
+	Reason      string `json:"reason"`
+	Created     int64  `json:"created"`
+	Status      string `json:"status"`
+	Replacement int    `json:"replacement,omitempty"`
+	Reviewed    int64  `json:"reviewed,omitempty"`
 }
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Charsets are the character sets a pool can restrict imported alts to
+var Charsets = []string{"any", "printable", "ascii"}
+
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+/*
+validator ~ The validation rules of a pool, compiled once per import
+*/
+type validator struct {
+	pool    Pool
+	pattern *regexp.Regexp
+}
+
+/*
+ValidatePool ~ Used to check the validation rules and alert settings of a pool make sense before they are saved
+*/
+func ValidatePool(pool Pool) error {
+	if pool.MinLength < 0 || pool.MaxLength < 1 || pool.MinLength > pool.MaxLength {
+		return errors.New("min_length has to be between 0 and max_length")
+	}
+	validCharset := false
+	for _, charset := range Charsets {
+		if pool.Charset == charset {
+			validCharset = true
+		}
+	}
+	if !validCharset {
+		return errors.New("invalid charset (any, printable, ascii)")
+	}
+	if pool.Pattern != "" {
+		_, err := regexp.Compile(pool.Pattern)
+		if err != nil {
+			return errors.New("invalid pattern: " + err.Error())
+		}
+	}
+	return validateAlert(pool)
+}
+
+func newValidator(pool Pool) (*validator, error) {
+	rules := &validator{pool: pool}
+	if pool.Pattern != "" {
+		var err error
+		rules.pattern, err = regexp.Compile(pool.Pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+/*
+loadValidators ~ Used to compile the rules of every pool that has settings, pools without settings get the default rules.
+An import loads them before its first batch since reading the pools inside the batch would hold a read lock
+that can't be upgraded to a write lock while another connection is writing
+*/
+func (database *DatabaseConnection) loadValidators() (map[string]*validator, error) {
+	result, err := database.Database.Query("SELECT " + poolColumns + " FROM pools")
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	validators := map[string]*validator{}
+	for result.Next() {
+		pool, err := scanPool(result)
+		if err != nil {
+			return nil, err
+		}
+		validators[pool.Name], err = newValidator(pool)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return validators, result.Err()
+}
+
+/*
+check ~ Used to run an item through the rules, returning the name of the first rule it breaks or an empty string if it is valid
+*/
+func (rules *validator) check(item *ImportItem) string {
+	// stored without encryption it couldn't be told apart from an encrypted password
+	if strings.HasPrefix(item.Password, encryptedPrefix) {
+		return "reserved_prefix"
+	}
+	for _, field := range []string{item.Email, item.Password} {
+		length := utf8.RuneCountInString(field)
+		if length < rules.pool.MinLength {
+			return "min_length"
+		}
+		if length > rules.pool.MaxLength {
+			return "max_length"
+		}
+		if !inCharset(field, rules.pool.Charset) {
+			return "charset"
+		}
+	}
+	if rules.pool.EmailCheck && !emailPattern.MatchString(item.Email) {
+		return "email"
+	}
+	if rules.pattern != nil && !rules.pattern.MatchString(item.Email+":"+item.Password) {
+		return "pattern"
+	}
+	return ""
+}
+
+func inCharset(field string, charset string) bool {
+	for _, character := range field {
+		switch charset {
+		case "printable":
+			if !unicode.IsPrint(character) {
+				return false
+			}
+		case "ascii":
+			if character < 0x20 || character > 0x7e {
+				return false
+			}
+		}
+	}
+	return true
+}
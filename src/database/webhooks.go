@@ -0,0 +1,314 @@
+package database
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+var (
+	// WebhookMaxAttempts is how many times a delivery is tried before it is given up on
+	WebhookMaxAttempts = 8
+	// WebhookBackoff is how long to wait before retrying a failed delivery, it doubles with every failed attempt
+	WebhookBackoff = 10 * time.Second
+	// WebhookMaxBackoff caps the wait between two attempts
+	WebhookMaxBackoff = time.Hour
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+/*
+ValidateWebhook ~ Used to check the url and events of a webhook before it is saved, * subscribes to every event
+*/
+func ValidateWebhook(webhookUrl string, events []string) error {
+	parsed, err := url.Parse(webhookUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("url has to be a http or https url")
+	}
+	if len(events) == 0 {
+		return errors.New("events not set")
+	}
+	for _, event := range events {
+		if event != "*" && !IsValidEvent(event) {
+			return errors.New("invalid event " + event + " (" + strings.Join(Events, ", ") + ", *)")
+		}
+	}
+	return nil
+}
+
+/*
+CreateWebhook ~ Used to subscribe a url to events, the secret deliveries are signed with is only returned here
+*/
+func (database *DatabaseConnection) CreateWebhook(webhookUrl string, events []string) (*Webhook, error) {
+	secret, err := randomId()
+	if err != nil {
+		return nil, err
+	}
+	webhook := Webhook{URL: webhookUrl, Events: events, Secret: secret}
+	err = database.Database.QueryRow("INSERT INTO webhooks (url, events, secret) VALUES (?, ?, ?) RETURNING id, created",
+		webhookUrl, strings.Join(events, ","), secret).Scan(&webhook.Id, &webhook.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+/*
+GetWebhooks ~ Used to get every webhook along with how many of its deliveries are pending or failed, without their secrets
+*/
+func (database *DatabaseConnection) GetWebhooks() ([]Webhook, error) {
+	result, err := database.Database.Query(`SELECT id, url, events, created,
+												(SELECT COUNT(*) FROM deliveries WHERE webhook = webhooks.id AND status = 'pending'),
+												(SELECT COUNT(*) FROM deliveries WHERE webhook = webhooks.id AND status = 'failed')
+											FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	webhooks := []Webhook{}
+	for result.Next() {
+		var webhook Webhook
+		var events string
+		err = result.Scan(&webhook.Id, &webhook.URL, &events, &webhook.Created, &webhook.Pending, &webhook.Failed)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, result.Err()
+}
+
+/*
+DeleteWebhook ~ Used to unsubscribe a webhook, its deliveries are deleted along with it
+*/
+func (database *DatabaseConnection) DeleteWebhook(webhookId int64) error {
+	tx, err := database.Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	deleted, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", webhookId)
+	if err != nil {
+		return err
+	}
+	affected, err := deleted.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWebhookNotFound
+	}
+	_, err = tx.Exec("DELETE FROM deliveries WHERE webhook = ?", webhookId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+GetDeliveries ~ Used to get the most recent deliveries of a webhook, optionally only those with a status
+*/
+func (database *DatabaseConnection) GetDeliveries(webhookId int64, status string, limit int) ([]Delivery, error) {
+	webhookExists, err := exists(database.Database, "SELECT 1 FROM webhooks WHERE id = ?", webhookId)
+	if err != nil {
+		return nil, err
+	}
+	if !webhookExists {
+		return nil, ErrWebhookNotFound
+	}
+
+	result, err := database.Database.Query(`SELECT id, webhook, event, payload, status, attempts, nextattempt, responsecode, error, created, delivered
+											FROM deliveries WHERE webhook = ? AND (? = '' OR status = ?) ORDER BY id DESC LIMIT ?`,
+		webhookId, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(result *sql.Rows) {
+		_ = result.Close()
+	}(result)
+
+	deliveries := []Delivery{}
+	for result.Next() {
+		var delivery Delivery
+		var payload string
+		err = result.Scan(&delivery.Id, &delivery.Webhook, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+			&delivery.NextAttempt, &delivery.ResponseCode, &delivery.Error, &delivery.Created, &delivery.Delivered)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		// only pending deliveries will be attempted again
+		if delivery.Status != "pending" {
+			delivery.NextAttempt = 0
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, result.Err()
+}
+
+/*
+queueDeliveries ~ Used to queue a delivery of an event for every webhook subscribed to it
+*/
+func (database *DatabaseConnection) queueDeliveries(event string, payload []byte) error {
+	_, err := database.Database.Exec(`INSERT INTO deliveries (webhook, event, payload, nextattempt)
+										SELECT id, ?, ?, ? FROM webhooks WHERE events = '*' OR ',' || events || ',' LIKE ?`,
+		event, string(payload), time.Now().Unix(), "%,"+event+",%")
+	return err
+}
+
+/*
+pendingDelivery ~ A queued delivery along with where it goes
+*/
+type pendingDelivery struct {
+	id       int64
+	event    string
+	payload  string
+	attempts int
+	url      string
+	secret   string
+}
+
+/*
+StartWebhookDelivery ~ Used to periodically send the queued deliveries that are due in the background.
+Deliveries stay queued in the database, so the ones that were pending when the server stopped are sent after a restart
+*/
+func (database *DatabaseConnection) StartWebhookDelivery(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := database.deliverPending()
+			if err != nil {
+				log.Println("error delivering webhooks:", err)
+			}
+		}
+	}()
+}
+
+/*
+deliverPending ~ Used to send every delivery that is due, at the same time so a slow webhook doesn't hold up the others
+*/
+func (database *DatabaseConnection) deliverPending() error {
+	result, err := database.Database.Query(`SELECT deliveries.id, deliveries.event, deliveries.payload, deliveries.attempts, webhooks.url, webhooks.secret
+											FROM deliveries JOIN webhooks ON webhooks.id = deliveries.webhook
+											WHERE deliveries.status = 'pending' AND deliveries.nextattempt <= ? ORDER BY deliveries.id LIMIT 100`,
+		time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	var due []pendingDelivery
+	for result.Next() {
+		var delivery pendingDelivery
+		err = result.Scan(&delivery.id, &delivery.event, &delivery.payload, &delivery.attempts, &delivery.url, &delivery.secret)
+		if err != nil {
+			_ = result.Close()
+			return err
+		}
+		due = append(due, delivery)
+	}
+	_ = result.Close()
+	if err = result.Err(); err != nil {
+		return err
+	}
+
+	var wait sync.WaitGroup
+	for _, delivery := range due {
+		wait.Add(1)
+		go func(delivery pendingDelivery) {
+			defer wait.Done()
+			database.deliver(delivery)
+		}(delivery)
+	}
+	wait.Wait()
+	return nil
+}
+
+/*
+deliver ~ Used to send a delivery and record the outcome, failed deliveries are retried with exponential backoff until they run out of attempts
+*/
+func (database *DatabaseConnection) deliver(delivery pendingDelivery) {
+	responseCode, err := postWebhook(delivery)
+	attempts := delivery.attempts + 1
+	now := time.Now()
+
+	if err == nil {
+		_, err = database.Database.Exec("UPDATE deliveries SET status = 'delivered', attempts = ?, responsecode = ?, error = '', delivered = ? WHERE id = ?",
+			attempts, responseCode, now.Unix(), delivery.id)
+		if err != nil {
+			log.Println("error recording webhook delivery:", err)
+		}
+		return
+	}
+
+	status := "pending"
+	if attempts >= WebhookMaxAttempts {
+		status = "failed"
+		log.Println(" [!] Gave up delivering", delivery.event, "to", delivery.url, "after", attempts, "attempts:", err)
+	}
+	backoff := WebhookBackoff << (attempts - 1)
+	if backoff > WebhookMaxBackoff || backoff <= 0 {
+		backoff = WebhookMaxBackoff
+	}
+	_, err = database.Database.Exec("UPDATE deliveries SET status = ?, attempts = ?, nextattempt = ?, responsecode = ?, error = ? WHERE id = ?",
+		status, attempts, now.Add(backoff).Unix(), responseCode, err.Error(), delivery.id)
+	if err != nil {
+		log.Println("error recording webhook delivery:", err)
+	}
+}
+
+/*
+SignWebhook ~ Used to sign the body of a delivery, the signature is the hex HMAC-SHA256 of the timestamp, a dot and the body
+keyed with the secret of the webhook. Receivers should compute the same and reject old timestamps to stop replays
+*/
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+postWebhook ~ Used to post a signed delivery, returning the status code the webhook responded with
+*/
+func postWebhook(delivery pendingDelivery) (int, error) {
+	body := []byte(delivery.payload)
+	request, err := http.NewRequest(http.MethodPost, delivery.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Dortgen-Webhook")
+	request.Header.Set("X-Dortgen-Event", delivery.event)
+	request.Header.Set("X-Dortgen-Delivery", strconv.FormatInt(delivery.id, 10))
+	request.Header.Set("X-Dortgen-Signature", "t="+strconv.FormatInt(timestamp, 10)+",v1="+SignWebhook(delivery.secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, errors.New("webhook responded with " + response.Status)
+	}
+	return response.StatusCode, nil
+}
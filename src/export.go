@@ -0,0 +1,71 @@
+package main
+
+import (
+	"DortgenAPI/src/database"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+/*
+runExport ~ exports stock from the command line, to stdout or the file set with -out.
+Usage: dortgen [flags] export [-format text|csv|jsonl] [-pool name] [-batch id] [-history] [-remove] [-out file]
+*/
+func runExport(args []string) error {
+	command := flag.NewFlagSet("export", flag.ExitOnError)
+	format := command.String("format", "text", "format to export in ("+strings.Join(database.ExportFormats, ", ")+")")
+	pool := command.String("pool", "", "only export this pool, empty exports every pool")
+	batch := command.Int64("batch", 0, "only export the alts of this import batch, 0 exports every batch")
+	history := command.Bool("history", false, "also export the alts that were dispensed")
+	remove := command.Bool("remove", false, "remove the exported alts from stock once they are written")
+	out := command.String("out", "", "file to export to, stdout if empty")
+	_ = command.Parse(args)
+
+	if !database.IsValidExportFormat(*format) {
+		log.Fatal("Invalid export format: " + *format)
+	}
+	if *pool != "" && !database.IsValidPoolName(*pool) {
+		log.Fatal("Invalid pool: " + *pool)
+	}
+
+	options := database.ExportOptions{
+		Pool:    *pool,
+		Batch:   *batch,
+		Format:  *format,
+		History: *history,
+		Remove:  *remove,
+	}
+	var output io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		closed := false
+		defer func(file *os.File) {
+			if !closed {
+				_ = file.Close()
+			}
+		}(file)
+		output = file
+
+		// the file has to be on disk before removed stock is deleted, a failed sync or close keeps the stock
+		options.Written = func() error {
+			err := file.Sync()
+			if err != nil {
+				return err
+			}
+			closed = true
+			return file.Close()
+		}
+	}
+
+	exported, err := database.Connection.ExportStock(output, options)
+	if err != nil {
+		return err
+	}
+	log.Println("Exported", exported, "alts")
+	return nil
+}
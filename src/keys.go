@@ -0,0 +1,62 @@
+package main
+
+import (
+	"DortgenAPI/src/database"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+)
+
+/*
+runGenerateKey ~ prints a new random encryption key to put in a key file or DORTGEN_KEY.
+Usage: dortgen genkey
+*/
+func runGenerateKey() error {
+	key, err := database.GenerateEncryptionKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+/*
+runRotateKey ~ wraps the data keys with a new master key and/or re-encrypts every password with a new data key.
+The current key is the one set with -keyfile or DORTGEN_KEY, the api has to be stopped while rotating.
+Usage: dortgen [-keyfile current] rotatekey [-newkeyfile file] [-reencrypt]
+*/
+func runRotateKey(args []string) error {
+	command := flag.NewFlagSet("rotatekey", flag.ExitOnError)
+	newKeyFile := command.String("newkeyfile", "", "file with the new master key, empty keeps the current key")
+	reencrypt := command.Bool("reencrypt", false, "re-encrypt every password with a new data key, this also encrypts plaintext passwords")
+	_ = command.Parse(args)
+
+	if *newKeyFile == "" && !*reencrypt {
+		return errors.New("nothing to do, set -newkeyfile and/or -reencrypt")
+	}
+
+	var newKey []byte
+	if *newKeyFile != "" {
+		var err error
+		newKey, err = database.LoadEncryptionKey(*newKeyFile)
+		if err != nil {
+			return err
+		}
+		if newKey == nil {
+			return errors.New("new key file is empty")
+		}
+	}
+
+	reencrypted, err := database.Connection.RotateEncryptionKey(newKey, *reencrypt)
+	if err != nil {
+		return err
+	}
+	if newKey != nil {
+		log.Println("Data keys are now wrapped with the new key, use it from now on")
+	}
+	if *reencrypt {
+		log.Println("Re-encrypted", reencrypted, "passwords")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"DortgenAPI/src/api"
 	"DortgenAPI/src/database"
+	"DortgenAPI/src/metrics"
 	"DortgenAPI/src/util"
 	"flag"
 	"github.com/go-chi/chi/v5"
@@ -13,9 +14,24 @@ import (
 	"time"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 var (
 	APIPort          = flag.String("port", "3000", "port to host the api on")
 	GenerateCooldown = flag.Int("cooldown", 10, "cooldown in seconds for generating alts")
+	MaxBatch         = flag.Int("maxbatch", 10, "default max amount of alts per generate call")
+	LeaseTimeout     = flag.Int("leasetimeout", 60, "seconds leased alts stay reserved before returning to stock")
+	ReplaceWindow    = flag.Int("replacewindow", 3600, "seconds after a dispense that a replacement can be requested")
+	ReplaceLimit     = flag.Int("replacelimit", 3, "default max replacements a key can receive per day")
+	RestockBatch     = flag.Int("restockbatch", 1000, "lines inserted per transaction when restocking")
+	ReportLimit      = flag.Int("reportlimit", 100, "max rejected lines listed in a detailed restock report")
+	Strategy         = flag.String("strategy", "fifo", "default dispense order for pools (fifo, lifo, random, priority)")
+	Inbox            = flag.Bool("inbox", false, "import files dropped in the inbox folder of the data folder")
+	InboxInterval    = flag.Int("inboxinterval", 5, "seconds between checks of the inbox folder")
+	AlertInterval    = flag.Int("alertinterval", 10, "seconds between checks of pool stock against low-stock thresholds")
+	AlertDebounce    = flag.Int("alertdebounce", 60, "seconds stock has to stay below or above a threshold before alerting")
+	KeyFile          = flag.String("keyfile", "", "file with the key passwords are encrypted with, "+database.EncryptionKeyEnv+" is used when not set")
 	router           chi.Router
 )
 
@@ -41,6 +57,8 @@ func init() {
 		})
 	})
 
+	router.Use(metrics.Middleware)
+
 	err := setupEndpoints()
 	if err != nil {
 		log.Fatal("Error setting up API endpoints: " + err.Error())
@@ -51,11 +69,41 @@ func init() {
 }
 
 func main() {
+	flag.Parse()
 
 	datapath := "dortgenapi"
 
+	api.Version = version
+	api.DefaultMaxBatch = *MaxBatch
+	api.LeaseTimeout = time.Duration(*LeaseTimeout) * time.Second
+	api.ReplaceWindow = time.Duration(*ReplaceWindow) * time.Second
+	api.ReplaceLimit = *ReplaceLimit
+
+	if !database.IsValidStrategy(*Strategy) {
+		log.Fatal("Invalid dispense strategy: " + *Strategy)
+	}
+	database.DefaultStrategy = *Strategy
+	database.DefaultImportBatchSize = *RestockBatch
+	database.MaxRejectedLines = *ReportLimit
+	database.AlertDebounce = time.Duration(*AlertDebounce) * time.Second
+
 	var err error
 
+	// printing a new key doesn't need the database
+	if flag.Arg(0) == "genkey" {
+		err = runGenerateKey()
+		if err != nil {
+			log.Fatal("Error generating key: " + err.Error())
+		}
+		return
+	}
+
+	// passwords are encrypted at rest once a key is set
+	database.EncryptionKey, err = database.LoadEncryptionKey(*KeyFile)
+	if err != nil {
+		log.Fatal("Error loading encryption key: " + err.Error())
+	}
+
 	// create the data folder if it doesn't exist
 	err = util.CreateFolderIfNotExists(datapath)
 	if err != nil {
@@ -71,6 +119,43 @@ func main() {
 	}
 	log.Println("Database started")
 
+	// run a command instead of starting the api when asked to
+	switch flag.Arg(0) {
+	case "export":
+		err = runExport(flag.Args()[1:])
+		if err != nil {
+			log.Fatal("Error exporting stock: " + err.Error())
+		}
+		return
+	case "rotatekey":
+		err = runRotateKey(flag.Args()[1:])
+		if err != nil {
+			log.Fatal("Error rotating key: " + err.Error())
+		}
+		return
+	}
+
+	// return expired leases to stock in the background
+	database.Connection.StartLeaseReaper(5 * time.Second)
+
+	// alert the webhooks of pools that run low on stock
+	database.Connection.StartStockAlerts(time.Duration(*AlertInterval) * time.Second)
+
+	// publish stock changes on the event bus for /events
+	database.Connection.StartStockEvents(time.Second)
+
+	// send queued events to the webhooks subscribed to them
+	database.Connection.StartWebhookDelivery(time.Second)
+
+	// import files dropped in the inbox folder
+	if *Inbox {
+		err = database.Connection.StartInboxWatcher(time.Duration(*InboxInterval) * time.Second)
+		if err != nil {
+			log.Fatal("Error starting inbox watcher: " + err.Error())
+		}
+		log.Println("Watching " + datapath + "/" + database.InboxFolder + " for restock files")
+	}
+
 	// start the web api
 	log.Println("Listening for API requests at port " + *APIPort)
 	err = http.ListenAndServe(":"+*APIPort, router)
@@ -116,9 +201,45 @@ func setupEndpoints() error {
 
 	router.Get("/validate", api.ValidateFunc)
 
+	router.Get("/metrics", metrics.Handler)
+
+	router.Get("/healthz", api.HealthzFunc)
+
+	router.Get("/readyz", api.ReadyzFunc)
+
+	router.Get("/events", api.EventsFunc)
+
 	router.Post("/create", api.CreateKeyFunc)
 
 	router.Post("/restock", api.RestockFunc)
 
+	router.Post("/confirm", api.ConfirmFunc)
+
+	router.Post("/report", api.ReportFunc)
+
+	router.Route("/admin", func(admin chi.Router) {
+		admin.Get("/reports", api.ReportsFunc)
+		admin.Post("/reports/{id}", api.ReviewReportFunc)
+		admin.Get("/pools", api.PoolsFunc)
+		admin.Post("/pools/{pool}", api.UpdatePoolFunc)
+		admin.Get("/jobs", api.JobsFunc)
+		admin.Get("/jobs/{id}", api.JobFunc)
+		admin.Get("/export", api.ExportFunc)
+		admin.Post("/export", api.ExportFunc)
+		admin.Get("/batches", api.BatchesFunc)
+		admin.Get("/batches/{id}", api.BatchFunc)
+		admin.Post("/batches/{id}/rollback", api.RollbackBatchFunc)
+		admin.Delete("/stock", api.DeleteStockFunc)
+		admin.Delete("/stock/{id}", api.DeleteAltFunc)
+		admin.Post("/stock/purge", api.PurgeStockFunc)
+		admin.Get("/audit", api.AuditFunc)
+		admin.Post("/keys/{owner}/disable", api.DisableKeyFunc)
+		admin.Post("/keys/{owner}/enable", api.EnableKeyFunc)
+		admin.Get("/webhooks", api.WebhooksFunc)
+		admin.Post("/webhooks", api.CreateWebhookFunc)
+		admin.Delete("/webhooks/{id}", api.DeleteWebhookFunc)
+		admin.Get("/webhooks/{id}/deliveries", api.DeliveriesFunc)
+	})
+
 	return nil
 }
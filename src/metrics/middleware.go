@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dortgen_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dortgen_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: DefaultBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+/*
+Middleware ~ Counts and times every request under the route pattern it matched, so ids in paths don't create new series
+*/
+func Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		wrapped := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
+		start := time.Now()
+		handler.ServeHTTP(wrapped, request)
+
+		route := "unmatched"
+		if routeContext := chi.RouteContext(request.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requests.WithLabelValues(route, request.Method, strconv.Itoa(status)).Inc()
+		latency.WithLabelValues(route, request.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}